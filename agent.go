@@ -0,0 +1,37 @@
+package lockfile
+
+import "runtime/debug"
+
+// WithAgent records agent in the lockfile, telling operators of a fleet running several versions
+// which binary took the lock. Read it via Agent.
+// An empty agent records the main module of this binary and its version as given by runtime/debug.ReadBuildInfo,
+// if known. Lockfiles written via WithPidfileCompat cannot record it.
+func WithAgent(agent string) Option {
+	return func(o *options) {
+		if agent == "" {
+			agent = buildAgent()
+		}
+		o.agent = agent
+	}
+}
+
+// buildAgent returns the path and version of the main module of this binary, "" if unknown.
+func buildAgent() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok || bi.Main.Path == "" {
+		return ""
+	}
+
+	return bi.Main.Path + "@" + bi.Main.Version
+}
+
+// Agent returns what the owner of the lockfile recorded about itself via WithAgent.
+// Lockfiles without it, like the ones written by older versions, report "".
+func (l Lockfile) Agent() (string, error) {
+	info, err := l.readInfo()
+	if err != nil {
+		return "", err
+	}
+
+	return info.Agent, nil
+}
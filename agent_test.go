@@ -0,0 +1,58 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAgent(t *testing.T) {
+	for _, codec := range []LockEncoder{pidCodec{}, JSONCodec{}} {
+		path := filepath.Join(t.TempDir(), "test.lck")
+		lf, err := New(path, WithAgent("deploy v1.2.3"), WithCodec(codec, JSONCodec{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%T: unexpected error: %v", codec, err)
+		}
+
+		if agent, err := lf.Agent(); err != nil || agent != "deploy v1.2.3" {
+			t.Errorf("%T: got agent %q, %v, want %q, <nil>", codec, agent, err, "deploy v1.2.3")
+		}
+
+		if err := lf.Unlock(); err != nil {
+			t.Fatalf("%T: unexpected error: %v", codec, err)
+		}
+	}
+}
+
+func TestAgentLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithAgent("deploy v1.2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if agent, err := lf.Agent(); err != nil || agent != "" {
+		t.Fatalf("got agent %q, %v, want \"\", <nil>", agent, err)
+	}
+}
+
+func TestAgentFromBuildInfo(t *testing.T) {
+	lf, err := New(filepath.Join(t.TempDir(), "test.lck"), WithAgent(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := lf.options().agent, buildAgent(); got != want {
+		t.Fatalf("got agent %q, want %q", got, want)
+	}
+}
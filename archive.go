@@ -0,0 +1,48 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// reapedTimeFormat is the format of the time a lockfile has been reaped in the names of archived lockfiles.
+// Unlike time.RFC3339, it is a valid file name everywhere.
+const reapedTimeFormat = "20060102T150405.000000000Z"
+
+// WithReapArchive copies the content of each lockfile TryLock reaps to dir before removing it,
+// so the owners, which died while holding the lock, can be investigated later.
+// The copy is called like the lockfile followed by ".reaped." and the time in UTC,
+// with the end of the name of the lockfile replaced by a hash as for WithTruncatedName, if that would be too long.
+// This is best effort: If the copy cannot be written, the lockfile is still reaped
+// and a warning is sent to the logger given by WithLogger.
+func WithReapArchive(dir string) Option {
+	return func(o *options) {
+		o.reapArchiveDir = dir
+	}
+}
+
+// archiveReaped copies the lockfile about to be reaped to the directory given by WithReapArchive.
+func (l Lockfile) archiveReaped() {
+	dir := l.options().reapArchiveDir
+	if dir == "" {
+		return
+	}
+
+	content, err := l.readLockfile()
+	if os.IsNotExist(err) {
+		// gone already, so nothing to reap
+		return
+	}
+	if err != nil {
+		l.warnf("lockfile: cannot archive reaped %s: %v", l.name, err)
+		return
+	}
+
+	now := l.options().clock.Now().UTC()
+	suffix := ".reaped." + now.Format(reapedTimeFormat)
+	archive := filepath.Join(dir, truncateName(filepath.Base(l.name), maxNameLen-len(suffix))+suffix)
+	if err := ioutil.WriteFile(archive, content, 0600); err != nil {
+		l.warnf("lockfile: cannot archive reaped %s: %v", l.name, err)
+	}
+}
@@ -0,0 +1,60 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithReapArchive(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	content := fmt.Sprintf("%d\nreason=\"crashed\"\n", GetDeadPID())
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithReapArchive(archive), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	name := filepath.Join(archive, "test.lck.reaped."+clock.Now().UTC().Format(reapedTimeFormat))
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Fatalf("got archived content %q, want %q", got, content)
+	}
+}
+
+func TestWithReapArchiveFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &recordingLogger{}
+	lf, err := New(path, WithReapArchive(filepath.Join(t.TempDir(), "missing")), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if len(logger.warnings) != 1 {
+		t.Fatalf("expected one warning, got %q", logger.warnings)
+	}
+}
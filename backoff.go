@@ -0,0 +1,84 @@
+package lockfile
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff tells Lock how long to wait between its attempts.
+// A Backoff used by several Lockfiles or goroutines must be safe for concurrent use.
+type Backoff interface {
+	// Next returns how long to wait after the failed attempt with the given number, starting at 0.
+	Next(attempt int) time.Duration
+	// Reset is called before Lock makes its first attempt.
+	Reset()
+}
+
+// WithBackoff replaces how long Lock waits between its attempts.
+// The default is ExponentialBackoff{Min: 10ms, Max: 1s} without jitter.
+func WithBackoff(b Backoff) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// ConstantBackoff always waits Delay.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// Next implements Backoff.
+func (b ConstantBackoff) Next(attempt int) time.Duration { return b.Delay }
+
+// Reset implements Backoff.
+func (ConstantBackoff) Reset() {}
+
+// LinearBackoff waits Initial first and Step longer after each further attempt, but never longer than Max.
+// A Max of 0 means no limit.
+type LinearBackoff struct {
+	Initial, Step, Max time.Duration
+}
+
+// Next implements Backoff.
+func (b LinearBackoff) Next(attempt int) time.Duration {
+	d := b.Initial + time.Duration(attempt)*b.Step
+	if b.Max > 0 && d > b.Max {
+		return b.Max
+	}
+
+	return d
+}
+
+// Reset implements Backoff.
+func (LinearBackoff) Reset() {}
+
+// ExponentialBackoff waits Min first and twice as long after each further attempt, but never longer than Max.
+// A Max of 0 means no limit.
+//
+// With Jitter between 0 and 1, each wait is shortened randomly by up to that fraction,
+// so waiters started together spread out instead of retrying all at once.
+type ExponentialBackoff struct {
+	Min, Max time.Duration
+	Jitter   float64
+}
+
+// Next implements Backoff.
+func (b ExponentialBackoff) Next(attempt int) time.Duration {
+	d := b.Min
+	for i := 0; i < attempt && (b.Max <= 0 || d < b.Max) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+
+	if b.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * b.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// Reset implements Backoff.
+func (ExponentialBackoff) Reset() {}
@@ -0,0 +1,83 @@
+package lockfile
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackoffs(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := [...]struct {
+		backoff Backoff
+		delays  []time.Duration
+	}{
+		{backoff: ConstantBackoff{Delay: 5 * ms}, delays: []time.Duration{5 * ms, 5 * ms, 5 * ms}},
+		{backoff: LinearBackoff{Initial: 10 * ms, Step: 5 * ms}, delays: []time.Duration{10 * ms, 15 * ms, 20 * ms, 25 * ms}},
+		{backoff: LinearBackoff{Initial: 10 * ms, Step: 5 * ms, Max: 18 * ms}, delays: []time.Duration{10 * ms, 15 * ms, 18 * ms, 18 * ms}},
+		{backoff: ExponentialBackoff{Min: 10 * ms, Max: time.Second}, delays: []time.Duration{10 * ms, 20 * ms, 40 * ms, 80 * ms}},
+		{backoff: ExponentialBackoff{Min: 10 * ms, Max: 30 * ms}, delays: []time.Duration{10 * ms, 20 * ms, 30 * ms, 30 * ms}},
+	}
+
+	for step, tc := range tests {
+		tc.backoff.Reset()
+
+		var got []time.Duration
+		for attempt := range tc.delays {
+			got = append(got, tc.backoff.Next(attempt))
+		}
+
+		if !reflect.DeepEqual(got, tc.delays) {
+			t.Errorf("%d: %T: got delays %v, want %v", step, tc.backoff, got, tc.delays)
+		}
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := ExponentialBackoff{Min: 100 * time.Millisecond, Max: time.Second, Jitter: 0.5}
+
+	for attempt := 0; attempt < 100; attempt++ {
+		want := ExponentialBackoff{Min: b.Min, Max: b.Max}.Next(attempt)
+
+		if got := b.Next(attempt); got > want || got < want/2 {
+			t.Fatalf("%d: got delay %v, want between %v and %v", attempt, got, want/2, want)
+		}
+	}
+}
+
+func TestExponentialBackoffUnlimited(t *testing.T) {
+	b := ExponentialBackoff{Min: time.Millisecond}
+
+	if got := b.Next(1000); got <= 0 {
+		t.Fatalf("got delay %v after many attempts, want a positive one", got)
+	}
+}
+
+func TestWithBackoff(t *testing.T) {
+	path, err := filepath.Abs("test_backoff.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	fs := &flakyFS{failures: 3}
+	retryAll := func(err error) bool { return true }
+
+	lf, err := New(path, WithClock(clock), withFilesystem(fs), WithRetryable(retryAll),
+		WithBackoff(LinearBackoff{Initial: time.Second, Step: time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.Lock(context.Background(), "main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; !reflect.DeepEqual(clock.waits, want) {
+		t.Fatalf("got waits %v, want %v", clock.waits, want)
+	}
+}
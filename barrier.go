@@ -0,0 +1,221 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// barrierLockExt is appended to the path of a barrier to name the lockfile guarding it.
+const barrierLockExt = ".lock"
+
+// barrierSeq tells apart the parties of this process waiting at barriers.
+var barrierSeq struct {
+	sync.Mutex
+	n uint64
+}
+
+// Barrier lets a number of cooperating processes, or goroutines thereof, proceed only once all of them arrived.
+// The parties waiting are recorded in a file, which is changed under a lockfile named like it plus ".lock".
+// Parties, which aren't running anymore, don't count, so a process dying while it waits doesn't release the others.
+// Once enough parties arrived, all of them proceed and the barrier can be used again.
+type Barrier struct {
+	path    string
+	parties int
+	opts    []Option
+}
+
+// barrierParty is a party waiting at a barrier.
+type barrierParty struct {
+	pid int
+	seq uint64 // tells apart the parties of the same process
+}
+
+// barrierState is what the file of a barrier records.
+type barrierState struct {
+	generation uint64 // increased each time the barrier releases its parties
+	parties    []barrierParty
+}
+
+// NewBarrier returns the barrier at path, which releases its parties, once parties of them are waiting.
+// The options apply to the lockfile guarding the barrier.
+func NewBarrier(path string, parties int, opts ...Option) (*Barrier, error) {
+	if parties < 1 {
+		return nil, fmt.Errorf("invalid number of parties %d", parties)
+	}
+
+	// checks the path and options
+	if _, err := New(path+barrierLockExt, opts...); err != nil {
+		return nil, err
+	}
+
+	return &Barrier{path: path, parties: parties, opts: opts}, nil
+}
+
+// Wait blocks until enough parties are waiting at the barrier or ctx is done.
+// procName is the name of the processes taking part, as expected by TryLock for the lockfile guarding the barrier.
+// If ctx is done first, the party leaves the barrier again and the error of ctx is returned.
+func (b *Barrier) Wait(ctx context.Context, procName string) error {
+	guard, err := New(b.path+barrierLockExt, append([]Option{WithInProcessRegistry()}, b.opts...)...)
+	if err != nil {
+		return err
+	}
+
+	barrierSeq.Lock()
+	barrierSeq.n++
+	me := barrierParty{pid: guard.options().pid, seq: barrierSeq.n}
+	barrierSeq.Unlock()
+
+	generation, err := b.join(ctx, guard, procName, me)
+	if err != nil {
+		return err
+	}
+
+	clock := guard.options().clock
+	backoff := guard.options().backoff
+	backoff.Reset()
+	for attempt := 0; ; attempt++ {
+		st, err := b.read(guard)
+		if err != nil {
+			return err
+		}
+
+		if st.generation != generation {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			passed, err := b.leave(guard, procName, me, generation)
+			if passed || err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-clock.After(backoff.Next(attempt)):
+		}
+	}
+}
+
+// join adds me to the parties waiting at the barrier and returns the generation it waits in.
+// If me is the last party needed, the barrier releases all of them right away.
+func (b *Barrier) join(ctx context.Context, guard Lockfile, procName string, me barrierParty) (uint64, error) {
+	if err := guard.Lock(ctx, procName); err != nil {
+		return 0, err
+	}
+	defer guard.Unlock()
+
+	st, err := b.read(guard)
+	if err != nil {
+		return 0, err
+	}
+
+	live := make([]barrierParty, 0, len(st.parties)+1)
+	for _, p := range st.parties {
+		running, err := guard.isRunning(p.pid)
+		if err != nil {
+			return 0, err
+		}
+
+		if running {
+			live = append(live, p)
+		}
+	}
+
+	generation := st.generation
+	st.parties = append(live, me)
+	if len(st.parties) >= b.parties {
+		st = barrierState{generation: generation + 1}
+	}
+
+	if err := b.write(guard, st); err != nil {
+		return 0, err
+	}
+
+	return generation, nil
+}
+
+// leave removes me from the parties waiting at the barrier in generation.
+// It reports whether the barrier released me meanwhile instead.
+func (b *Barrier) leave(guard Lockfile, procName string, me barrierParty, generation uint64) (bool, error) {
+	if err := guard.Lock(context.Background(), procName); err != nil {
+		return false, err
+	}
+	defer guard.Unlock()
+
+	st, err := b.read(guard)
+	if err != nil {
+		return false, err
+	}
+
+	if st.generation != generation {
+		return true, nil
+	}
+
+	parties := st.parties[:0]
+	for _, p := range st.parties {
+		if p != me {
+			parties = append(parties, p)
+		}
+	}
+	st.parties = parties
+
+	return false, b.write(guard, st)
+}
+
+// read returns what the file of the barrier records. A missing file records nothing.
+func (b *Barrier) read(guard Lockfile) (barrierState, error) {
+	content, err := readShared(guard.fs(), b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return barrierState{}, nil
+		}
+		return barrierState{}, err
+	}
+
+	var st barrierState
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			continue
+		}
+
+		switch key, value := line[:i], line[i+1:]; key {
+		case "generation":
+			st.generation, _ = strconv.ParseUint(value, 10, 64)
+		case "party":
+			var p barrierParty
+			if _, err := fmt.Sscanf(value, "%d:%d", &p.pid, &p.seq); err == nil && p.pid > 0 {
+				st.parties = append(st.parties, p)
+			}
+		}
+	}
+
+	return st, nil
+}
+
+// write atomically replaces the file of the barrier with one recording st.
+func (b *Barrier) write(guard Lockfile, st barrierState) error {
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "generation=%d\n", st.generation)
+	for _, p := range st.parties {
+		fmt.Fprintf(&data, "party=%d:%d\n", p.pid, p.seq)
+	}
+
+	// Next to the barrier rather than in the directory given by WithTempDir, so it can be renamed to it.
+	tmp, cleanup, err := guard.makeTempFileIn(filepath.Dir(b.path), b.path, data.Bytes())
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	return guard.fs().Rename(tmp, b.path)
+}
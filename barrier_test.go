@@ -0,0 +1,110 @@
+package lockfile
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBarrier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.barrier")
+
+	const parties = 5
+	b, err := NewBarrier(path, parties, WithBackoff(ConstantBackoff{Delay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// twice to check that the barrier can be used again
+	for round := 0; round < 2; round++ {
+		var wg sync.WaitGroup
+		errs := make(chan error, parties)
+		for i := 0; i < parties; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				errs <- b.Wait(ctx, "main")
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("%d: unexpected error: %v", round, err)
+			}
+		}
+	}
+}
+
+func TestBarrierBlocksUntilAllArrived(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.barrier")
+
+	// a party, which died while waiting, doesn't count
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("generation=0\nparty=%d:1\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBarrier(path, 2, WithBackoff(ConstantBackoff{Delay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := b.Wait(ctx, "main"); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	st, err := b.read(Lockfile{name: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.parties) != 0 {
+		t.Fatalf("got parties %v after leaving, want none", st.parties)
+	}
+}
+
+func TestNewBarrierInvalid(t *testing.T) {
+	if _, err := NewBarrier(filepath.Join(t.TempDir(), "test.barrier"), 0); err == nil {
+		t.Error("expected error for no parties")
+	}
+
+	if _, err := NewBarrier("relative.barrier", 2); err != ErrNeedAbsPath {
+		t.Errorf("expected error %v, got %v", ErrNeedAbsPath, err)
+	}
+}
+
+// crossDirRenameFS fails renaming files between directories as if they were on different filesystems.
+type crossDirRenameFS struct {
+	osFS
+}
+
+func (fs crossDirRenameFS) Rename(oldname, newname string) error {
+	if filepath.Dir(oldname) != filepath.Dir(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return fs.osFS.Rename(oldname, newname)
+}
+
+func TestBarrierWithTempDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.barrier")
+
+	b, err := NewBarrier(path, 1, WithTempDir(t.TempDir()), withFilesystem(crossDirRenameFS{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Wait(context.Background(), "main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Capabilities tells which primitives the filesystem of a lockfile supports.
+type Capabilities struct {
+	Exclusive    bool // creating a file fails, if it exists (O_EXCL)
+	HardLink     bool // hard links can be created and fail, if the target exists; TryLock relies on this
+	AtomicRename bool // renaming replaces an existing file
+	Flock        bool // advisory locks via flock(2) exclude each other
+	NoFollow     bool // opening a symlink can be refused (O_NOFOLLOW)
+}
+
+// CheckCapabilities probes the directory of the lockfile for the primitives it supports,
+// so callers can choose a safe configuration at startup.
+// It creates scratch files next to the lockfile and removes them again, but leaves the lockfile alone.
+// An error is only returned, if the scratch files cannot be created at all.
+func (l Lockfile) CheckCapabilities() (Capabilities, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(l.name), filepath.Base(l.name)+".probe.")
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(name, []byte("old"), 0600); err != nil {
+		return Capabilities{}, err
+	}
+
+	return Capabilities{
+		Exclusive:    probeExclusive(name),
+		HardLink:     probeHardLink(name, filepath.Join(dir, "link")),
+		AtomicRename: probeAtomicRename(name, filepath.Join(dir, "new")),
+		Flock:        probeFlock(name),
+		NoFollow:     probeNoFollow(name, filepath.Join(dir, "symlink")),
+	}, nil
+}
+
+// probeExclusive reports whether creating the existing file name exclusively fails.
+func probeExclusive(name string) bool {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err == nil {
+		_ = f.Close()
+		return false
+	}
+
+	return os.IsExist(err)
+}
+
+// probeHardLink reports whether name can be linked to link, but not twice.
+func probeHardLink(name, link string) bool {
+	if err := os.Link(name, link); err != nil {
+		return false
+	}
+	defer os.Remove(link)
+
+	return os.IsExist(os.Link(name, link))
+}
+
+// probeAtomicRename reports whether renaming another file to name replaces it.
+func probeAtomicRename(name, other string) bool {
+	if err := ioutil.WriteFile(other, []byte("new"), 0600); err != nil {
+		return false
+	}
+	defer os.Remove(other)
+
+	if err := os.Rename(other, name); err != nil {
+		return false
+	}
+
+	content, err := ioutil.ReadFile(name)
+	return err == nil && string(content) == "new"
+}
@@ -0,0 +1,31 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// probeFlock reports whether an exclusive flock(2) on name keeps another descriptor from getting one.
+func probeFlock(name string) bool {
+	first, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer first.Close()
+
+	second, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer second.Close()
+
+	if err := syscall.Flock(int(first.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return false
+	}
+	defer syscall.Flock(int(first.Fd()), syscall.LOCK_UN)
+
+	return syscall.Flock(int(second.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) == syscall.EWOULDBLOCK
+}
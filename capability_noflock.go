@@ -0,0 +1,9 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package lockfile
+
+// probeFlock reports that flock(2) is not supported, as this platform lacks it.
+func probeFlock(name string) bool {
+	return false
+}
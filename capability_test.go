@@ -0,0 +1,50 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	dir := t.TempDir()
+
+	lf, err := New(filepath.Join(dir, "test.lck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caps, err := lf.CheckCapabilities()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// TryLock works here, so does what it relies on.
+	if !caps.Exclusive || !caps.HardLink || !caps.AtomicRename {
+		t.Fatalf("got %+v, want exclusive creation, hard links and atomic renames", caps)
+	}
+
+	if runtime.GOOS == "linux" && (!caps.Flock || !caps.NoFollow) {
+		t.Fatalf("got %+v, want flock and O_NOFOLLOW on linux", caps)
+	}
+
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("expected scratch files to be removed, found %d files", len(names))
+	}
+}
+
+func TestCheckCapabilitiesMissingDir(t *testing.T) {
+	lf, err := New(filepath.Join(t.TempDir(), "missing", "test.lck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lf.CheckCapabilities(); err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
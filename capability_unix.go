@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris || aix
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris aix
+
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// probeNoFollow reports whether opening a symlink to name fails with O_NOFOLLOW.
+func probeNoFollow(name, symlink string) bool {
+	if err := os.Symlink(name, symlink); err != nil {
+		return false
+	}
+	defer os.Remove(symlink)
+
+	f, err := os.OpenFile(symlink, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err == nil {
+		_ = f.Close()
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,6 @@
+package lockfile
+
+// probeNoFollow reports that O_NOFOLLOW is not supported, as Windows lacks it.
+func probeNoFollow(name, symlink string) bool {
+	return false
+}
@@ -0,0 +1,85 @@
+package lockfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// cliUsage describes the command line understood by RunCLI.
+const cliUsage = `usage: lockfile <command> <path>
+
+commands:
+  acquire  acquire the lock for the calling process, e.g. a shell script
+  release  release the lock held by the calling process
+  status   print the status of the lock
+`
+
+// Exit codes of RunCLI.
+const (
+	exitOK      = 0
+	exitFailure = 1 // like a busy lock
+	exitUsage   = 2
+)
+
+// RunCLI runs the command line args without the program name, e.g. os.Args[1:], and returns the exit code.
+// It lets a program embed a minimal command for scripts:
+//
+//	lockfile acquire <path>  # exits with 1, if the lock is busy
+//	lockfile release <path>
+//	lockfile status <path>
+//
+// As the command exits right away, the lock is owned by its parent process, e.g. the shell running the script,
+// which is recorded in the lockfile and must be alive to keep the lock.
+// Any live owner keeps others from acquiring the lock, regardless of its name.
+// Results go to stdout, errors to stderr.
+func RunCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprint(stderr, cliUsage)
+		return exitUsage
+	}
+
+	cmd, path := args[0], args[1]
+	path, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "lockfile: %v\n", err)
+		return exitUsage
+	}
+
+	lf, err := New(path, WithPIDResolver(getppid))
+	if err != nil {
+		fmt.Fprintf(stderr, "lockfile: %v\n", err)
+		return exitUsage
+	}
+
+	switch cmd {
+	case "acquire":
+		err = lf.TryLock("")
+	case "release":
+		err = lf.Unlock()
+	case "status":
+		var status LockStatus
+		status, err = lf.Status()
+		if err == nil || status.Corrupt {
+			fmt.Fprintln(stdout, status)
+			err = nil
+		}
+	default:
+		fmt.Fprintf(stderr, "lockfile: unknown command %q\n", cmd)
+		fmt.Fprint(stderr, cliUsage)
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "lockfile: %s: %v\n", path, err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// getppid returns the pid of the parent process, which owns the locks acquired by RunCLI.
+func getppid() (int, error) {
+	return os.Getppid(), nil
+}
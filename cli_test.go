@@ -0,0 +1,66 @@
+package lockfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCLI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	tests := [...]struct {
+		args   []string
+		code   int
+		stdout string // expected prefix
+		stderr string // expected prefix
+	}{
+		{args: []string{"status", path}, stdout: path + ": not locked\n"},
+		{args: []string{"acquire", path}},
+		{args: []string{"status", path}, stdout: fmt.Sprintf("%s: locked by pid %d", path, os.Getppid())},
+		{args: []string{"acquire", path}}, // already ours
+		{args: []string{"release", path}},
+		{args: []string{"release", path}, code: exitFailure, stderr: "lockfile: " + path + ": " + ErrRogueDeletion.Error()},
+		{args: []string{"status"}, code: exitUsage, stderr: "usage:"},
+		{args: []string{"frobnicate", path}, code: exitUsage, stderr: `lockfile: unknown command "frobnicate"`},
+	}
+
+	for step, tc := range tests {
+		var stdout, stderr bytes.Buffer
+		code := RunCLI(tc.args, &stdout, &stderr)
+
+		if code != tc.code {
+			t.Errorf("%d: %v: got exit code %d, want %d (stderr %q)", step, tc.args, code, tc.code, stderr.String())
+		}
+		if !strings.HasPrefix(stdout.String(), tc.stdout) || (tc.stdout == "") != (stdout.Len() == 0) {
+			t.Errorf("%d: %v: got stdout %q, want %q", step, tc.args, stdout.String(), tc.stdout)
+		}
+		if !strings.HasPrefix(stderr.String(), tc.stderr) || (tc.stderr == "") != (stderr.Len() == 0) {
+			t.Errorf("%d: %v: got stderr %q, want %q", step, tc.args, stderr.String(), tc.stderr)
+		}
+	}
+}
+
+func TestRunCLIBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := RunCLI([]string{"acquire", path}, &stdout, &stderr); code != exitFailure {
+		t.Fatalf("got exit code %d, want %d", code, exitFailure)
+	}
+
+	if want := "lockfile: " + path + ": " + ErrBusy.Error() + "\n"; stderr.String() != want {
+		t.Fatalf("got stderr %q, want %q", stderr.String(), want)
+	}
+
+	if code := RunCLI([]string{"status", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("got exit code %d, want %d", code, exitOK)
+	}
+}
@@ -0,0 +1,292 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockInfo is what a lockfile records about its owner.
+type LockInfo struct {
+	PID      int       // pid of the owner
+	Token    uint64    // fencing token handed out by TryLockFenced, 0 if none
+	Acquired time.Time // when the lock has been acquired, if recorded via WithTimestamp
+	Reason   string    // why the lock has been acquired, if recorded via TryLockWithReason
+	Hostname string    // host of the owner, if recorded via WithHostname or WithHostAware
+	Expires  time.Time // when the lock expires, if acquired via TryLockTTL
+	BootID   string    // boot of the host of the owner, if recorded via WithRebootDetection
+	Renewals uint64    // how often the owner called Refresh, only passed to WithPreReapHook, see RenewalCount
+	Agent    string    // binary and version of the owner, if recorded via WithAgent
+}
+
+// LockEncoder turns a LockInfo into lockfile content.
+type LockEncoder interface {
+	Encode(LockInfo) ([]byte, error)
+}
+
+// LockDecoder turns lockfile content back into a LockInfo.
+// Content which cannot be decoded should be reported as ErrInvalidPid,
+// so TryLock knows that it may replace the lockfile.
+type LockDecoder interface {
+	Decode([]byte) (LockInfo, error)
+}
+
+// pidCodec is the default format: the pid on a line of its own,
+// followed by a "key=value" line for each other field recorded.
+// It also reads lockfiles written by JSONCodec.
+type pidCodec struct{}
+
+// The content is built in a single buffer, so it is written to the lockfile by a single write(2).
+func (pidCodec) Encode(info LockInfo) ([]byte, error) {
+	b := make([]byte, 0, 128)
+	b = strconv.AppendInt(b, int64(info.PID), 10)
+	b = append(b, '\n')
+	if info.Token != 0 {
+		b = append(b, "token="...)
+		b = strconv.AppendUint(b, info.Token, 10)
+		b = append(b, '\n')
+	}
+	if !info.Acquired.IsZero() {
+		b = append(b, "acquired="...)
+		b = info.Acquired.AppendFormat(b, time.RFC3339Nano)
+		b = append(b, '\n')
+	}
+	if info.Reason != "" {
+		b = append(b, "reason="...)
+		b = strconv.AppendQuote(b, info.Reason)
+		b = append(b, '\n')
+	}
+	if info.Hostname != "" {
+		b = append(b, "host="...)
+		b = append(b, info.Hostname...)
+		b = append(b, '\n')
+	}
+	if !info.Expires.IsZero() {
+		b = append(b, "expires="...)
+		b = info.Expires.AppendFormat(b, time.RFC3339Nano)
+		b = append(b, '\n')
+	}
+	if info.BootID != "" {
+		b = append(b, "boot="...)
+		b = append(b, info.BootID...)
+		b = append(b, '\n')
+	}
+	if info.Agent != "" {
+		b = append(b, "agent="...)
+		b = strconv.AppendQuote(b, info.Agent)
+		b = append(b, '\n')
+	}
+
+	return b, nil
+}
+
+func (pidCodec) Decode(content []byte) (LockInfo, error) {
+	if isJSON(content) {
+		return JSONCodec{}.Decode(content)
+	}
+
+	pid, err := scanPidLine(content)
+	if err != nil {
+		return LockInfo{}, err
+	}
+
+	info := LockInfo{PID: pid}
+	fields := scanFields(content)
+	if token, err := strconv.ParseUint(fields["token"], 10, 64); err == nil {
+		info.Token = token
+	}
+	if acquired, err := time.Parse(time.RFC3339Nano, fields["acquired"]); err == nil {
+		info.Acquired = acquired
+	}
+	if reason, err := strconv.Unquote(fields["reason"]); err == nil {
+		info.Reason = reason
+	}
+	info.Hostname = fields["host"]
+	if expires, err := time.Parse(time.RFC3339Nano, fields["expires"]); err == nil {
+		info.Expires = expires
+	}
+	info.BootID = fields["boot"]
+	if agent, err := strconv.Unquote(fields["agent"]); err == nil {
+		info.Agent = agent
+	}
+
+	return info, nil
+}
+
+// pidfileCodec writes nothing but the pid, see WithPidfileCompat.
+type pidfileCodec struct {
+	pidCodec
+}
+
+func (pidfileCodec) Encode(info LockInfo) ([]byte, error) {
+	return []byte(strconv.Itoa(info.PID)), nil
+}
+
+// scanFields returns the "key=value" lines of content.
+func scanFields(content []byte) map[string]string {
+	fields := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '='); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+
+	return fields
+}
+
+// JSONCodec stores the lockfile content as a JSON object.
+// It still reads lockfiles in the default format, where the fields missing there are left empty.
+type JSONCodec struct{}
+
+// lockInfoJSON is the JSON representation of LockInfo.
+type lockInfoJSON struct {
+	PID      int    `json:"pid"`
+	Token    uint64 `json:"token,omitempty"`
+	Acquired string `json:"acquired,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Hostname string `json:"host,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	BootID   string `json:"boot,omitempty"`
+	Agent    string `json:"agent,omitempty"`
+}
+
+// Encode implements LockEncoder.
+func (JSONCodec) Encode(info LockInfo) ([]byte, error) {
+	j := lockInfoJSON{PID: info.PID, Token: info.Token, Reason: info.Reason, Hostname: info.Hostname, BootID: info.BootID, Agent: info.Agent}
+	if !info.Acquired.IsZero() {
+		j.Acquired = info.Acquired.Format(time.RFC3339Nano)
+	}
+	if !info.Expires.IsZero() {
+		j.Expires = info.Expires.Format(time.RFC3339Nano)
+	}
+
+	content, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
+
+// Decode implements LockDecoder.
+func (JSONCodec) Decode(content []byte) (LockInfo, error) {
+	if !isJSON(content) {
+		return pidCodec{}.Decode(content)
+	}
+
+	var j lockInfoJSON
+	if err := json.Unmarshal(content, &j); err != nil {
+		return LockInfo{}, ErrInvalidPid
+	}
+
+	info := LockInfo{PID: j.PID, Token: j.Token, Reason: j.Reason, Hostname: j.Hostname, BootID: j.BootID, Agent: j.Agent}
+	if j.Acquired != "" {
+		acquired, err := time.Parse(time.RFC3339Nano, j.Acquired)
+		if err != nil {
+			return LockInfo{}, ErrInvalidPid
+		}
+		info.Acquired = acquired
+	}
+	if j.Expires != "" {
+		expires, err := time.Parse(time.RFC3339Nano, j.Expires)
+		if err != nil {
+			return LockInfo{}, ErrInvalidPid
+		}
+		info.Expires = expires
+	}
+
+	return info, nil
+}
+
+// isJSON reports whether content looks like a JSON object.
+func isJSON(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), []byte("{"))
+}
+
+// readInfo reads and decodes the lockfile.
+func (l Lockfile) readInfo() (LockInfo, error) {
+	content, err := l.readLockfile()
+	if err != nil {
+		return LockInfo{}, err
+	}
+
+	info, err := l.options().decoder.Decode(content)
+	if err != nil {
+		return LockInfo{}, err
+	}
+
+	// try hard for pids. If no pid, the lockfile is junk anyway and we delete it.
+	if info.PID <= 0 {
+		return LockInfo{}, ErrInvalidPid
+	}
+
+	return info, nil
+}
+
+// Canonicalize rewrites the lockfile we own in the format configured via WithCodec,
+// recording the current time, hostname, boot id and agent as configured, but keeping the fencing token,
+// reason, expiry and renewal count. Lockfiles written by older versions or with other options become canonical this way.
+// The lockfile is replaced atomically, so we own the lock all the time.
+// A lockfile we don't own is reported as ErrRogueDeletion.
+func (l Lockfile) Canonicalize() (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	info, err := l.readInfo()
+	switch {
+	case err == ErrInvalidPid, os.IsNotExist(err):
+		return ErrRogueDeletion
+	case err != nil:
+		return err
+	case !l.isMine(info):
+		return ErrRogueDeletion
+	case l.st != nil && replaced(l.name, l.st):
+		return ErrRogueDeletion
+	}
+
+	renewals, err := l.RenewalCount()
+	if err != nil {
+		return err
+	}
+
+	canonical := l.newInfo()
+	canonical.Token = info.Token
+	canonical.Reason = info.Reason
+	canonical.Expires = info.Expires
+
+	if err := l.replace(canonical, nil); err != nil {
+		return err
+	}
+
+	if renewals != 0 {
+		if err := l.writeRenewals(canonical.PID, renewals); err != nil {
+			return err
+		}
+	}
+
+	if l.st != nil {
+		hold(l.name, l.st)
+		touch(l.st, l.options().clock.Now())
+	}
+
+	return nil
+}
+
+// newInfo returns what to record about us as the owner of the lockfile.
+func (l Lockfile) newInfo() LockInfo {
+	info := LockInfo{PID: l.options().pid}
+	if l.options().timestamp {
+		info.Acquired = l.options().clock.Now()
+	}
+	info.Hostname = l.options().hostname
+	info.BootID = l.options().bootID
+	info.Agent = l.options().agent
+
+	return info
+}
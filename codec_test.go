@@ -0,0 +1,302 @@
+package lockfile
+
+import (
+	"fmt"
+	"github.com/shirou/gopsutil/v4/process"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ownerCodec stores the pid as "owner:<pid>" to check the lock logic doesn't depend on the format.
+type ownerCodec struct{}
+
+func (ownerCodec) Encode(info LockInfo) ([]byte, error) {
+	return []byte(fmt.Sprintf("owner:%d", info.PID)), nil
+}
+
+func (ownerCodec) Decode(content []byte) (LockInfo, error) {
+	var info LockInfo
+	if _, err := fmt.Sscanf(string(content), "owner:%d", &info.PID); err != nil {
+		return LockInfo{}, ErrInvalidPid
+	}
+	return info, nil
+}
+
+func TestCustomCodec(t *testing.T) {
+	path, err := filepath.Abs("test_codec.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithCodec(ownerCodec{}, ownerCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("owner:%d", os.Getpid()); string(got) != want {
+		t.Fatalf("got content %q, want %q", got, want)
+	}
+
+	proc, err := lf.GetOwner()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if proc.Pid != os.Getpid() {
+		t.Fatalf("got owner %d, want %d", proc.Pid, os.Getpid())
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lockfile %q should be removed, got %v", path, err)
+	}
+}
+
+func TestCustomCodecReplacesUndecodableContent(t *testing.T) {
+	path, err := filepath.Abs("test_codec.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a lockfile in the default format is junk for ownerCodec
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getppid())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	lf, err := New(path, WithCodec(ownerCodec{}, ownerCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	acquired := time.Date(2020, 2, 29, 12, 30, 0, 42, time.UTC)
+	infos := []LockInfo{
+		{PID: 1},
+		{PID: 42, Token: 7},
+		{PID: 42, Acquired: acquired},
+		{PID: 42, Reason: "DB migration v42\n=\"quoted\""},
+		{PID: 42, Hostname: "db1"},
+		{PID: 42, Expires: acquired.Add(time.Hour)},
+		{PID: 42, BootID: "c0ffee00-0000-4000-8000-000000000000"},
+		{PID: 42, Agent: "deploy/v1.2.3 (go1.21)"},
+	}
+
+	codecs := []struct {
+		enc LockEncoder
+		dec LockDecoder
+	}{
+		{pidCodec{}, pidCodec{}},
+		{JSONCodec{}, JSONCodec{}},
+		// each decodes what the other one encodes
+		{pidCodec{}, JSONCodec{}},
+		{JSONCodec{}, pidCodec{}},
+	}
+
+	for i, c := range codecs {
+		for _, want := range infos {
+			content, err := c.enc.Encode(want)
+			if err != nil {
+				t.Fatalf("%d: %+v: unexpected error: %v", i, want, err)
+			}
+
+			got, err := c.dec.Decode(content)
+			if err != nil {
+				t.Fatalf("%d: %q: unexpected error: %v", i, content, err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%d: got %+v, want %+v", i, got, want)
+			}
+		}
+	}
+}
+
+func TestWithPidfileCompat(t *testing.T) {
+	path, err := filepath.Abs("test_codec.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithPidfileCompat(), WithTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(os.Getpid()); string(content) != want {
+		t.Fatalf("got content %q, want %q", content, want)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPidfileCodecRoundTrip(t *testing.T) {
+	content, err := (pidfileCodec{}).Encode(LockInfo{PID: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := (pidfileCodec{}).Decode(content)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", content, err)
+	}
+	if info.PID != 1234 {
+		t.Fatalf("%q: got pid %d, want 1234", content, info.PID)
+	}
+}
+
+func TestJSONCodecInvalid(t *testing.T) {
+	for _, content := range []string{"{", `{"pid":"a"}`, `{"pid":1,"acquired":"yesterday"}`} {
+		if _, err := (JSONCodec{}).Decode([]byte(content)); err != ErrInvalidPid {
+			t.Errorf("%q: expected error %q, got %v", content, ErrInvalidPid, err)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	// as written by an older version without any options
+	legacy := fmt.Sprintf("%d\nreason=%q\n", os.Getpid(), "migration")
+	if err := ioutil.WriteFile(path, []byte(legacy), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithCodec(JSONCodec{}, JSONCodec{}), WithTimestamp(), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Adopt(selfName()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := (JSONCodec{}).Encode(LockInfo{PID: os.Getpid(), Acquired: clock.Now(), Reason: "migration"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(want) {
+		t.Fatalf("got content %q, want %q", content, want)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Canonicalize(); err != ErrRogueDeletion {
+		t.Fatalf("released: expected error %q, got %v", ErrRogueDeletion, err)
+	}
+}
+
+func BenchmarkPidCodecEncode(b *testing.B) {
+	info := LockInfo{PID: 12345, Token: 42, Acquired: time.Now(), Hostname: "db1"}
+	for i := 0; i < b.N; i++ {
+		if _, err := (pidCodec{}).Encode(info); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNoPartialContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	lf, err := New(path, WithTimestamp(), WithHostname("db1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := lf.TryLock("main"); err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+				return
+			}
+			if err := lf.Unlock(); err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := (pidCodec{}).Decode(content)
+		if len(content) == 0 || content[len(content)-1] != '\n' || err != nil || info.Hostname != "db1" {
+			t.Fatalf("got partial content %q", content)
+		}
+	}
+}
+
+// selfName returns the name of this process.
+func selfName() string {
+	if proc, err := process.NewProcess(int32(os.Getpid())); err == nil {
+		if name, err := proc.Name(); err == nil {
+			return name
+		}
+	}
+
+	return DefaultProcName()
+}
@@ -0,0 +1,51 @@
+package lockfile
+
+// CreationKind tells how TryLockEx came to own the lockfile.
+type CreationKind int
+
+const (
+	// Created means that there was no lockfile, so a brand-new one has been created.
+	Created CreationKind = iota + 1
+	// ReplacedEmpty means that a lockfile without a valid pid, like an empty one, has been replaced.
+	ReplacedEmpty
+	// ReapedStale means that the lockfile of a dead owner or a stale one has been reaped and replaced.
+	ReapedStale
+	// ReplacedOwn means that a lockfile naming us already has been replaced.
+	ReplacedOwn
+)
+
+// String describes the kind for humans.
+func (k CreationKind) String() string {
+	switch k {
+	case Created:
+		return "created"
+	case ReplacedEmpty:
+		return "replaced empty"
+	case ReapedStale:
+		return "reaped stale"
+	case ReplacedOwn:
+		return "replaced own"
+	default:
+		return "unknown"
+	}
+}
+
+// TryLockResult is what TryLockEx reports about a successful acquisition.
+type TryLockResult struct {
+	Kind CreationKind // how the lockfile came to be ours
+}
+
+// TryLockEx works like TryLock, but also tells whether the lockfile has been created
+// or an existing one has been replaced, e.g. for logging that a stale lock has been reaped.
+// With WithSoftMode, the Kind of a lock acquired despite its live owner is 0,
+// as is the Kind of any lock while SetGloballyDisabled is in effect.
+func (l Lockfile) TryLockEx(expProcName string) (TryLockResult, error) {
+	kind, err := l.acquireKind(expProcName, func() (LockInfo, error) {
+		return l.newInfo(), nil
+	})
+	if err != nil {
+		return TryLockResult{}, err
+	}
+
+	return TryLockResult{Kind: kind}, nil
+}
@@ -0,0 +1,92 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLockExKind(t *testing.T) {
+	tests := [...]struct {
+		content string // of the lockfile before, none if empty
+		kind    CreationKind
+	}{
+		{kind: Created},
+		{content: "\n", kind: ReplacedEmpty},
+		{content: "junk\n", kind: ReplacedEmpty},
+		{content: fmt.Sprintf("%d\n", GetDeadPID()), kind: ReapedStale},
+	}
+
+	for step, tc := range tests {
+		path := filepath.Join(t.TempDir(), "test.lck")
+		if tc.content != "" {
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		lf, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := lf.TryLockEx("main")
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+
+		if res.Kind != tc.kind {
+			t.Errorf("%d: got kind %v, want %v", step, res.Kind, tc.kind)
+		}
+
+		if err := lf.Unlock(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+	}
+}
+
+func TestTryLockExReplacedOwn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lf.TryLockEx("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := lf.TryLockEx("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Kind != ReplacedOwn {
+		t.Fatalf("got kind %v, want %v", res.Kind, ReplacedOwn)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTryLockExBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	name := writeBusyLockfile(t, path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := lf.TryLockEx(name)
+	if err != ErrBusy {
+		t.Fatalf("got error %v, want %v", err, ErrBusy)
+	}
+
+	if res.Kind != 0 {
+		t.Fatalf("got kind %v for a busy lock", res.Kind)
+	}
+}
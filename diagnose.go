@@ -0,0 +1,92 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DiagReport gathers everything relevant to tell why a lockfile behaves as it does.
+// It is meant to be attached to bug reports and serializes to JSON.
+type DiagReport struct {
+	Path        string `json:"path"`                // path name of the lockfile
+	AbsPath     string `json:"abs_path"`            // path name with symlinks in its directory resolved
+	DirExists   bool   `json:"dir_exists"`          // whether the directory of the lockfile exists
+	DirWritable bool   `json:"dir_writable"`        // whether we may create files in that directory
+	FileExists  bool   `json:"file_exists"`         // whether the lockfile exists
+	Content     string `json:"content"`             // content of the lockfile as read
+	PID         int    `json:"pid,omitempty"`       // pid of the owner, 0 if there is no valid lockfile
+	PIDError    string `json:"pid_error,omitempty"` // why the content doesn't name an owner
+	Alive       bool   `json:"alive"`               // whether the owner is running
+	OurPID      int    `json:"our_pid"`             // pid recorded by us when acquiring the lock
+	Platform    string `json:"platform"`            // GOOS/GOARCH
+	FSType      string `json:"fs_type,omitempty"`   // type of the filesystem, if known
+}
+
+// Diagnose reports everything relevant about the lockfile and its owner without changing either.
+// Problems of the lockfile itself are part of the report.
+// Other errors, like missing permissions to read the lockfile, are returned along with what is known so far.
+func (l Lockfile) Diagnose() (DiagReport, error) {
+	dir := filepath.Dir(l.name)
+	report := DiagReport{
+		Path:     l.name,
+		AbsPath:  l.name,
+		OurPID:   l.options().pid,
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		report.DirExists = true
+		report.DirWritable = dirWritable(dir)
+		report.FSType = fsType(dir)
+
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			report.AbsPath = filepath.Join(resolved, filepath.Base(l.name))
+		}
+	}
+
+	if _, err := os.Lstat(l.name); err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return report, err
+	}
+	report.FileExists = true
+
+	content, err := l.readLockfile()
+	switch {
+	case err == ErrIsDirectory, err == ErrNotRegularFile, err == ErrOversizeLockfile:
+		report.PIDError = err.Error()
+		return report, nil
+	case err != nil:
+		return report, err
+	}
+	report.Content = string(content)
+
+	info, err := l.options().decoder.Decode(content)
+	if err == nil && info.PID <= 0 {
+		err = ErrInvalidPid
+	}
+	if err != nil {
+		report.PIDError = err.Error()
+		if err == ErrInvalidPid {
+			_, raw, _ := scanPidLineVerbose(content)
+			report.PIDError = fmt.Sprintf("%v: first line %q", err, raw)
+		}
+		return report, nil
+	}
+	report.PID = info.PID
+
+	if l.isForeign(info) {
+		// We cannot tell, so assume the best like TryLock does.
+		report.Alive = true
+		return report, nil
+	}
+
+	if report.Alive, err = l.isRunning(info.PID); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
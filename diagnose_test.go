@@ -0,0 +1,95 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	free, err := lf.Diagnose()
+	if err != nil {
+		t.Fatalf("free lockfile: unexpected error: %v", err)
+	}
+
+	if !free.DirExists || !free.DirWritable || free.FileExists || free.PID != 0 || free.Alive {
+		t.Fatalf("free lockfile: got %+v", free)
+	}
+	if free.Path != path || free.OurPID != os.Getpid() || free.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Fatalf("free lockfile: got %+v", free)
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil && free.AbsPath != filepath.Join(resolved, "test.lck") {
+		t.Fatalf("free lockfile: got absolute path %q", free.AbsPath)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	held, err := lf.Diagnose()
+	if err != nil {
+		t.Fatalf("held lockfile: unexpected error: %v", err)
+	}
+
+	if !held.FileExists || held.PID != os.Getpid() || !held.Alive || held.PIDError != "" {
+		t.Fatalf("held lockfile: got %+v", held)
+	}
+	if want := strconv.Itoa(os.Getpid()) + "\n"; held.Content != want {
+		t.Fatalf("held lockfile: got content %q, want %q", held.Content, want)
+	}
+
+	content, err := json.Marshal(held)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded DiagReport
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != held {
+		t.Fatalf("got %+v after JSON round trip, want %+v", decoded, held)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("Diagnose changed the lock: got %v, %v", mine, err)
+	}
+}
+
+func TestDiagnoseInvalidLockfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte("junk\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := lf.Diagnose()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := ErrInvalidPid.Error() + `: first line "junk"`; !report.FileExists || report.Content != "junk\n" || report.PIDError != want {
+		t.Fatalf("got %+v", report)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Diagnose removed the lockfile: %v", err)
+	}
+}
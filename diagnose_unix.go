@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris || aix
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris aix
+
+package lockfile
+
+import "syscall"
+
+// dirWritable reports whether we may create files in dir.
+func dirWritable(dir string) bool {
+	const wOK = 2 // W_OK of access(2)
+	return syscall.Access(dir, wOK) == nil
+}
@@ -0,0 +1,10 @@
+package lockfile
+
+import "os"
+
+// dirWritable reports whether we may create files in dir.
+// Without access control lists, this only tells whether dir is read-only.
+func dirWritable(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.Mode().Perm()&0200 != 0
+}
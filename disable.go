@@ -0,0 +1,31 @@
+package lockfile
+
+import "sync"
+
+// globallyDisabled is the switch flipped by SetGloballyDisabled.
+var globallyDisabled struct {
+	sync.RWMutex
+	disabled bool
+}
+
+// SetGloballyDisabled turns all locking of this package into no-ops, if disabled is true.
+// TryLock and its variants, Lock, Refresh and Unlock succeed then without touching any file.
+// Locks acquired before are left alone, but Unlock doesn't remove their lockfiles while disabled.
+//
+// This is meant for integration tests of applications using this package,
+// which would otherwise have to replace the locking at every place it is set up.
+// Never use it in production, as nothing is locked at all while disabled.
+func SetGloballyDisabled(disabled bool) {
+	globallyDisabled.Lock()
+	defer globallyDisabled.Unlock()
+
+	globallyDisabled.disabled = disabled
+}
+
+// isGloballyDisabled reports whether locking has been disabled via SetGloballyDisabled.
+func isGloballyDisabled() bool {
+	globallyDisabled.RLock()
+	defer globallyDisabled.RUnlock()
+
+	return globallyDisabled.disabled
+}
@@ -0,0 +1,52 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGloballyDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	name := writeBusyLockfile(t, path)
+
+	before, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(name); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+
+	SetGloballyDisabled(true)
+	defer SetGloballyDisabled(false)
+
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(after) != string(before) {
+		t.Fatalf("lockfile changed from %q to %q", before, after)
+	}
+
+	SetGloballyDisabled(false)
+
+	if err := lf.TryLock(name); err != ErrBusy {
+		t.Fatalf("expected error %v after enabling again, got %v", ErrBusy, err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/nightlyone/lockfile"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+func main() {
+	expProcName := "graceful"
+	lock, err := lockfile.New(filepath.Join(os.TempDir(), "lock.me.now.lck"))
+	if err != nil {
+		fmt.Printf("Cannot init lock. reason: %v", err)
+		os.Exit(1)
+	}
+
+	// Stop waiting for or holding the lock on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Blocks until we own the lock, unless we are asked to stop first.
+	if err := lock.Lock(ctx, expProcName); err != nil {
+		fmt.Printf("Cannot lock %q, reason: %v", lock, err)
+		os.Exit(1)
+	}
+
+	// Runs on the way out of main, as we leave the loop below on a signal.
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			fmt.Printf("Cannot unlock %q, reason: %v", lock, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Unlocked %q\n", lock)
+	}()
+
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	for {
+		fmt.Printf("Locked %q\n", lock)
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("Shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
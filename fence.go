@@ -0,0 +1,112 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// TryLockFenced works like TryLock, but also hands out a fencing token.
+// The token increases with every successful acquisition, including the ones reaping
+// a stale lockfile, so storage guarded by the lock can reject writes carrying a token
+// older than the newest one it has seen.
+//
+// The token is written alongside the pid right after the lock has been acquired, so the lockfile
+// lacks it for a moment. As Unlock removes the lockfile, the highest token handed out so far
+// is also kept in a ".fence" file next to it.
+func (l Lockfile) TryLockFenced(expProcName string) (token uint64, err error) {
+	// tokens recorded in lockfiles, which predate the fence file, as seen while acquiring
+	var seen uint64
+	err = l.acquire(expProcName, func() (LockInfo, error) {
+		if info, err := l.readInfo(); err == nil && info.Token > seen {
+			seen = info.Token
+		}
+		return l.newInfo(), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if isGloballyDisabled() || l.st != nil && l.options().emptyContent {
+		return 0, nil
+	}
+
+	// Only the owner of the lock advances the fence, so no token is handed out twice.
+	token, err = l.advanceFence(seen)
+	if err != nil {
+		_ = l.Unlock()
+		return 0, l.wrapErr(err)
+	}
+
+	return token, nil
+}
+
+// fenceName returns the name of the file keeping the highest token for the lockfile name.
+func fenceName(name string) string {
+	return name + ".fence"
+}
+
+// advanceFence hands out the next token after the ones in the fence file and seen,
+// records it in the fence file and then in the lockfile we own.
+func (l Lockfile) advanceFence(seen uint64) (uint64, error) {
+	last, err := l.readFence()
+	if err != nil {
+		return 0, err
+	}
+	if seen > last {
+		last = seen
+	}
+	token := last + 1
+
+	// Persist the token before we hand it out.
+	// A crash in between merely skips a token, but never hands it out twice.
+	if err := l.writeFence(token); err != nil {
+		return 0, err
+	}
+
+	info, err := l.readInfo()
+	if err != nil {
+		return 0, err
+	}
+	info.Token = token
+	if err := l.replace(info, nil); err != nil {
+		return 0, err
+	}
+	if l.st != nil {
+		identify(l.name, l.st)
+	}
+
+	return token, nil
+}
+
+// readFence returns the highest token handed out for the lockfile so far.
+func (l Lockfile) readFence() (uint64, error) {
+	content, err := readShared(l.fs(), fenceName(l.name))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	return scanToken(content), nil
+}
+
+// writeFence atomically replaces the highest token known for the lockfile.
+func (l Lockfile) writeFence(token uint64) error {
+	tmp, cleanup, err := l.makeTempFile(fenceName(l.name), []byte(fmt.Sprintf("token=%d\n", token)))
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	return l.fs().Rename(tmp, fenceName(l.name))
+}
+
+// scanToken returns the fencing token recorded in content or 0, if there is none.
+func scanToken(content []byte) uint64 {
+	token, err := strconv.ParseUint(scanFields(content)["token"], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return token
+}
@@ -0,0 +1,121 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLockFencedIncreases(t *testing.T) {
+	path, err := filepath.Abs("test_fence.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fenceName(path))
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last uint64
+	for i := 0; i < 3; i++ {
+		token, err := lf.TryLockFenced("main")
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if token <= last {
+			t.Fatalf("%d: token %d doesn't exceed previous token %d", i, token, last)
+		}
+		last = token
+
+		if err := lf.Unlock(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestTryLockFencedAdvancesOnStaleReap(t *testing.T) {
+	path, err := filepath.Abs("test_fence.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fenceName(path))
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := fmt.Sprintf("%d\ntoken=5\n", GetDeadPID())
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	token, err := lf.TryLockFenced("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if token <= 5 {
+		t.Fatalf("token %d doesn't exceed token 5 of the stale lockfile", token)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("%d\ntoken=%d\n", os.Getpid(), token); string(got) != want {
+		t.Fatalf("got content %q, want %q", got, want)
+	}
+}
+
+func TestScanToken(t *testing.T) {
+	tests := [...]struct {
+		input []byte
+		token uint64
+	}{
+		{},
+		{input: []byte("1\n")},
+		{input: []byte("1\ntoken=x\n")},
+		{input: []byte("1\ntoken=42\n"), token: 42},
+		{input: []byte("token=7"), token: 7},
+	}
+
+	for step, tc := range tests {
+		if got := scanToken(tc.input); got != tc.token {
+			t.Errorf("%d: expected token %d, got %d", step, tc.token, got)
+		}
+	}
+}
+
+func TestTryLockFencedBusyKeepsFence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(fenceName(path), []byte("token=5\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	name := writeBusyLockfile(t, path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lf.TryLockFenced(name); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+
+	// Losing contenders must not claim a token, or the winner might get the same one.
+	content, err := ioutil.ReadFile(fenceName(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := scanToken(content); token != 5 {
+		t.Fatalf("got fence %d, want 5", token)
+	}
+}
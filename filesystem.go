@@ -0,0 +1,163 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// filesystem are the operations TryLock changes the filesystem with and reads lockfiles by.
+// Tests replace it to simulate filesystems misbehaving in ways hard to set up for real.
+type filesystem interface {
+	Open(name string) (io.ReadCloser, error)
+	TempFile(dir, pattern string) (*os.File, error)
+	Link(oldname, newname string) error
+	Remove(name string) error
+	Stat(name string) (os.FileInfo, error)
+	Rename(oldname, newname string) error
+}
+
+// osFS is the filesystem of the operating system.
+type osFS struct{}
+
+func (osFS) Open(name string) (io.ReadCloser, error)        { return openShared(name) }
+func (osFS) TempFile(dir, pattern string) (*os.File, error) { return ioutil.TempFile(dir, pattern) }
+func (osFS) Link(oldname, newname string) error             { return os.Link(oldname, newname) }
+func (osFS) Remove(name string) error                       { return os.Remove(name) }
+func (osFS) Stat(name string) (os.FileInfo, error)          { return os.Stat(name) }
+func (osFS) Rename(oldname, newname string) error           { return os.Rename(oldname, newname) }
+
+// fs returns the filesystem to use for l.
+func (l Lockfile) fs() filesystem {
+	var fs filesystem = eintrFS{l.options().fs}
+	if timeout := l.options().ioTimeout; timeout > 0 {
+		fs = timeoutFS{fs: fs, timeout: timeout}
+	}
+
+	return fs
+}
+
+// eintrFS retries operations of fs interrupted by a signal.
+// This matters for processes handling lots of signals.
+type eintrFS struct {
+	fs filesystem
+}
+
+func (e eintrFS) Open(name string) (r io.ReadCloser, err error) {
+	for {
+		if r, err = e.fs.Open(name); !errors.Is(err, syscall.EINTR) {
+			return r, err
+		}
+	}
+}
+
+func (e eintrFS) TempFile(dir, pattern string) (f *os.File, err error) {
+	for {
+		if f, err = e.fs.TempFile(dir, pattern); !errors.Is(err, syscall.EINTR) {
+			return f, err
+		}
+	}
+}
+
+func (e eintrFS) Link(oldname, newname string) (err error) {
+	for {
+		if err = e.fs.Link(oldname, newname); !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+func (e eintrFS) Remove(name string) (err error) {
+	for {
+		if err = e.fs.Remove(name); !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+func (e eintrFS) Stat(name string) (fi os.FileInfo, err error) {
+	for {
+		if fi, err = e.fs.Stat(name); !errors.Is(err, syscall.EINTR) {
+			return fi, err
+		}
+	}
+}
+
+func (e eintrFS) Rename(oldname, newname string) (err error) {
+	for {
+		if err = e.fs.Rename(oldname, newname); !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// checkSameDevice returns ErrCrossDevice, if the directories dir and other are on different filesystems.
+// If we cannot tell, they are assumed to be on the same one.
+func checkSameDevice(dir, other string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	otherFi, err := os.Stat(other)
+	if err != nil {
+		return err
+	}
+
+	dev, ok := device(fi)
+	otherDev, otherOk := device(otherFi)
+	if ok && otherOk && dev != otherDev {
+		return fmt.Errorf("%w: %s and %s", ErrCrossDevice, dir, other)
+	}
+
+	return nil
+}
+
+// WithWritabilityCheck makes New check that it may create files in the directory of the lockfile
+// and the one given by WithTempDir, by creating and removing a scratch file there.
+// If not, New returns ErrDirNotWritable, so a misconfiguration shows at startup instead of at the first TryLock.
+func WithWritabilityCheck() Option {
+	return func(o *options) {
+		o.checkWritable = true
+	}
+}
+
+// checkWritable returns ErrDirNotWritable, if we cannot create and remove a file in dir.
+func checkWritable(fs filesystem, dir string) error {
+	probe, err := fs.TempFile(dir, ".lockfile-probe.")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDirNotWritable, err)
+	}
+
+	_ = probe.Close()
+	if err := fs.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("%w: %v", ErrDirNotWritable, err)
+	}
+
+	return nil
+}
+
+// isReadOnly reports whether err tells that we may not write where we tried to.
+func isReadOnly(err error) bool {
+	return errors.Is(err, syscall.EROFS) || os.IsPermission(err)
+}
+
+// isCrossDevice reports whether err tells that source and target are on different filesystems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// readShared reads the whole file name and closes it right away,
+// so readers never keep the owner of a lockfile from removing it.
+func readShared(fs filesystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
@@ -0,0 +1,239 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// readOnlyFS is a filesystem refusing all changes like a read-only mount.
+type readOnlyFS struct{}
+
+func (readOnlyFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (readOnlyFS) TempFile(dir, pattern string) (*os.File, error) {
+	return nil, &os.PathError{Op: "open", Path: filepath.Join(dir, pattern), Err: syscall.EROFS}
+}
+
+func (readOnlyFS) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+
+func (readOnlyFS) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EROFS}
+}
+
+func (readOnlyFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (readOnlyFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+
+// withFilesystem replaces the filesystem TryLock changes.
+func withFilesystem(fs filesystem) Option {
+	return func(o *options) {
+		o.fs = fs
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	path, err := filepath.Abs("test_readonly.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, withFilesystem(readOnlyFS{}), WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != ErrReadOnlyFS {
+		t.Errorf("free lock: expected error %q, got %v", ErrReadOnlyFS, err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	if err := lf.TryLock(name); err != ErrBusy {
+		t.Errorf("busy lock: expected error %q, got %v", ErrBusy, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != ErrReadOnlyFS {
+		t.Errorf("stale lock: expected error %q, got %v", ErrReadOnlyFS, err)
+	}
+}
+
+func TestReadOnlyDisabled(t *testing.T) {
+	path, err := filepath.Abs("test_readonly.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, withFilesystem(readOnlyFS{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected error %q, got %v", syscall.EROFS, err)
+	}
+}
+
+func TestWritabilityCheck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	if _, err := New(path, withFilesystem(readOnlyFS{}), WithWritabilityCheck()); !errors.Is(err, ErrDirNotWritable) {
+		t.Fatalf("expected error %q, got %v", ErrDirNotWritable, err)
+	}
+
+	if _, err := New(path, WithWritabilityCheck()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The scratch file is gone.
+	if names, err := ioutil.ReadDir(dir); err != nil || len(names) != 0 {
+		t.Fatalf("got %d files in %s, %v, want none", len(names), dir, err)
+	}
+}
+
+// halfWrittenFS reads lockfiles as empty the first n times, like while they are being written.
+type halfWrittenFS struct {
+	osFS
+	n     int
+	opens int
+}
+
+func (fs *halfWrittenFS) Open(name string) (io.ReadCloser, error) {
+	fs.opens++
+	if fs.opens <= fs.n {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	return fs.osFS.Open(name)
+}
+
+func TestInvalidPidRetries(t *testing.T) {
+	path, err := filepath.Abs("test_filesystem.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	fs := &halfWrittenFS{n: 1}
+	lf, err := New(path, withFilesystem(fs), WithClock(newFakeClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(name); err != ErrBusy {
+		t.Fatalf("expected error %q, got %v", ErrBusy, err)
+	}
+
+	if fs.opens != 2 {
+		t.Errorf("got %d reads, want 2", fs.opens)
+	}
+
+	// Without retries, the half written lockfile is replaced.
+	lf, err = New(path, withFilesystem(&halfWrittenFS{n: 1}), WithInvalidPidRetries(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// interruptedFS fails each operation once with EINTR, like when a signal arrives.
+type interruptedFS struct {
+	osFS
+	calls map[string]int
+}
+
+// interrupted reports whether op is interrupted this time.
+func (fs *interruptedFS) interrupted(op string) bool {
+	fs.calls[op]++
+	return fs.calls[op] == 1
+}
+
+func (fs *interruptedFS) Open(name string) (io.ReadCloser, error) {
+	if fs.interrupted("open") {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EINTR}
+	}
+	return fs.osFS.Open(name)
+}
+
+func (fs *interruptedFS) TempFile(dir, pattern string) (*os.File, error) {
+	if fs.interrupted("tempfile") {
+		return nil, &os.PathError{Op: "open", Path: filepath.Join(dir, pattern), Err: syscall.EINTR}
+	}
+	return fs.osFS.TempFile(dir, pattern)
+}
+
+func (fs *interruptedFS) Link(oldname, newname string) error {
+	if fs.interrupted("link") {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EINTR}
+	}
+	return fs.osFS.Link(oldname, newname)
+}
+
+func (fs *interruptedFS) Remove(name string) error {
+	if fs.interrupted("remove") {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EINTR}
+	}
+	return fs.osFS.Remove(name)
+}
+
+func TestRetryEINTR(t *testing.T) {
+	path, err := filepath.Abs("test_filesystem.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stale lockfile to read and remove
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	fs := &interruptedFS{calls: map[string]int{}}
+	lf, err := New(path, withFilesystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, op := range []string{"open", "tempfile", "link", "remove"} {
+		if fs.calls[op] < 2 {
+			t.Errorf("%s: not retried after EINTR, got %d calls", op, fs.calls[op])
+		}
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,263 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// errFlockWaitPending tells that the flock(2) of an earlier flockWait for the file still waits.
+var errFlockWaitPending = errors.New("waiting for flock already")
+
+// WithEmptyContent makes TryLock rely on flock(2) alone instead of recording our pid in the lockfile.
+// The lockfile is created, if missing, and truncated to be empty, while the lock is held
+// by an exclusive flock on a descriptor kept open until Unlock.
+// The kernel releases the lock, once this process exits, so there are no stale lockfiles to reap.
+//
+// Unlock leaves the empty lockfile in place, as removing it would let a process, which opened it just before,
+// acquire the lock alongside the next one creating the lockfile anew.
+// As nothing is recorded, functions reading the lockfile, like GetOwner or Status, report ErrInvalidPid.
+// Use IsLocked to tell whether the lock is held instead.
+// All processes using the lockfile must use this option, as the empty lockfile is invalid for the others.
+// Platforms without flock(2), like Windows, make New return ErrFlockUnsupported.
+func WithEmptyContent() Option {
+	return func(o *options) {
+		o.emptyContent = true
+	}
+}
+
+// LockWithTimeout blocks until it owns the lock, but at most for timeout, and returns ErrBusy then.
+// For WithEmptyContent, it waits within flock(2), so the kernel hands over a released lock right away
+// without polling. As that wait cannot be interrupted, it keeps a goroutine until the lock is released,
+// which drops the lock, if it has been granted after timeout. While such a goroutine is left for the lockfile,
+// other calls poll with the backoff given by WithBackoff instead, so retrying doesn't pile them up.
+// For other lockfiles, it works like AcquireWithin without a context.
+func (l Lockfile) LockWithTimeout(procName string, timeout time.Duration) (err error) {
+	if l.st == nil || !l.options().emptyContent {
+		return l.AcquireWithin(context.Background(), procName, timeout)
+	}
+
+	defer func() { err = l.wrapErr(err) }()
+
+	if isGloballyDisabled() {
+		return nil
+	}
+
+	clock := l.options().clock
+	start := clock.Now()
+	expired := clock.After(timeout)
+	_, err = l.acquireFlock(func(f *os.File) error {
+		err := flockWait(f, expired)
+		if err == errFlockWaitPending {
+			return l.pollFlock(f, expired)
+		}
+		return err
+	})
+	if err == nil {
+		l.startLease()
+		l.observeWait(start)
+	}
+
+	return err
+}
+
+// pollFlock takes the flock on f like flockWait, but retries flockTry with the backoff given by WithBackoff.
+func (l Lockfile) pollFlock(f *os.File, expired <-chan time.Time) error {
+	clock := l.options().clock
+	backoff := l.options().backoff
+	backoff.Reset()
+	for attempt := 0; ; attempt++ {
+		if err := flockTry(f); err != ErrBusy {
+			return err
+		}
+
+		select {
+		case <-expired:
+			return ErrBusy
+		case <-clock.After(backoff.Next(attempt)):
+		}
+	}
+}
+
+// acquireFlock implements acquireKind for WithEmptyContent, taking the flock via lock.
+func (l Lockfile) acquireFlock(lock func(*os.File) error) (CreationKind, error) {
+	if err := l.checkDuplicate(); err != nil {
+		return 0, err
+	}
+
+	if l.flockHeld() {
+		return ReplacedOwn, nil
+	}
+
+	// Don't even try to handle a pipe or device someone put in our way.
+	if err := checkRegular(l.name); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	var kind CreationKind
+	var f *os.File
+	for {
+		var err error
+		kind, f, err = l.openFlock(lock)
+		if err != nil {
+			return 0, err
+		}
+		if f != nil {
+			break
+		}
+	}
+
+	// Only now the content is ours to clear, e.g. a pid left by a process not using WithEmptyContent.
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+
+	if mode := l.options().fileMode; mode != 0 {
+		if err := f.Chmod(mode); err != nil {
+			_ = f.Close()
+			return 0, err
+		}
+	}
+
+	hold(l.name, l.st)
+	registry.Lock()
+	l.st.flocked = f
+	registry.Unlock()
+
+	touch(l.st, l.options().clock.Now())
+	l.recordDir()
+	l.record("acquired")
+	return kind, nil
+}
+
+// openFlock opens the lockfile, creating it if missing, and locks it.
+// The file is nil, if the lockfile has been removed or replaced before we got the lock,
+// e.g. by its previous owner unlocking it, since the flock of an unlinked file protects nothing.
+func (l Lockfile) openFlock(lock func(*os.File) error) (CreationKind, *os.File, error) {
+	kind := Created
+	f, err := os.OpenFile(l.name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		kind = ReplacedEmpty
+		f, err = os.OpenFile(l.name, os.O_RDWR, 0)
+	}
+	if os.IsNotExist(err) {
+		// removed between both opens
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := lock(f); err != nil {
+		_ = f.Close()
+		return 0, nil, err
+	}
+
+	locked, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return 0, nil, err
+	}
+
+	current, err := os.Lstat(l.name)
+	if err != nil && !os.IsNotExist(err) {
+		_ = f.Close()
+		return 0, nil, err
+	}
+
+	if err != nil || !os.SameFile(locked, current) {
+		_ = f.Close()
+		return 0, nil, nil
+	}
+
+	return kind, f, nil
+}
+
+// unlockFlock implements unlock for WithEmptyContent.
+func (l Lockfile) unlockFlock(leased *leasedLock) error {
+	if leased != nil {
+		registry.Lock()
+		current := l.st.flocked == leased.flocked
+		registry.Unlock()
+		if !current {
+			// We released it meanwhile and acquired it anew, so the lease has been renewed.
+			return ErrRogueDeletion
+		}
+	}
+
+	held := l.flockHeld()
+
+	// Closing the descriptor releases the flock.
+	release(l.name, l.st)
+	if !held {
+		return ErrRogueDeletion
+	}
+
+	l.record("released")
+	return nil
+}
+
+// flockHeld reports whether we hold the flock of the file currently found at the path of the lockfile.
+func (l Lockfile) flockHeld() bool {
+	registry.Lock()
+	f := l.st.flocked
+	registry.Unlock()
+
+	if f == nil {
+		return false
+	}
+
+	locked, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	current, err := os.Lstat(l.name)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(locked, current)
+}
+
+// IsLocked reports whether anyone, including us, holds the lock.
+// For WithEmptyContent, this is probed via flock(2).
+// Otherwise the lockfile must name an owner, which is still running or on another host.
+func (l Lockfile) IsLocked() (bool, error) {
+	if !l.options().emptyContent {
+		_, err := l.owner()
+		switch {
+		case err == nil:
+			return true, nil
+		case err == ErrDeadOwner, err == ErrInvalidPid, os.IsNotExist(err):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	if l.st != nil && l.flockHeld() {
+		return true, nil
+	}
+
+	f, err := os.Open(l.name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	switch err := flockTry(f); err {
+	case nil:
+		// Closing the descriptor releases the flock right away.
+		return false, nil
+	case ErrBusy:
+		return true, nil
+	default:
+		return false, err
+	}
+}
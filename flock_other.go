@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package lockfile
+
+import (
+	"os"
+	"time"
+)
+
+// haveFlock tells whether this platform supports flock(2), see WithEmptyContent.
+const haveFlock = false
+
+// flockTry reports that flock(2) is not supported, as this platform lacks it.
+func flockTry(f *os.File) error {
+	return ErrFlockUnsupported
+}
+
+// flockWait reports that flock(2) is not supported, as this platform lacks it.
+func flockWait(f *os.File, timeout <-chan time.Time) error {
+	return ErrFlockUnsupported
+}
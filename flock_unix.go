@@ -0,0 +1,87 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lockfile
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// haveFlock tells whether this platform supports flock(2), see WithEmptyContent.
+const haveFlock = true
+
+// flockTry takes an exclusive flock(2) on f without waiting.
+// If someone else holds one, it returns ErrBusy.
+func flockTry(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		switch err {
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return ErrBusy
+		}
+		return err
+	}
+}
+
+// flockWaiting holds the names of the files flockWait waits for within flock(2), even after it timed out.
+var flockWaiting = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// flockWait takes an exclusive flock(2) on f, waiting until timeout fires for others to release theirs.
+// If it fires first, it returns ErrBusy.
+// The blocking flock(2) runs on a duplicate of the descriptor, so closing f doesn't
+// pull the descriptor from under it. Once f is closed, a flock granted late is dropped with the duplicate.
+// Until then, the goroutine and the duplicate are kept, so while one of them is left for a file,
+// flockWait returns errFlockWaitPending instead of leaving another one.
+func flockWait(f *os.File, timeout <-chan time.Time) error {
+	flockWaiting.Lock()
+	pending := flockWaiting.names[f.Name()]
+	if !pending {
+		flockWaiting.names[f.Name()] = true
+	}
+	flockWaiting.Unlock()
+	if pending {
+		return errFlockWaitPending
+	}
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		flockWaiting.Lock()
+		delete(flockWaiting.names, f.Name())
+		flockWaiting.Unlock()
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			_ = syscall.Close(fd)
+			flockWaiting.Lock()
+			delete(flockWaiting.names, f.Name())
+			flockWaiting.Unlock()
+		}()
+
+		for {
+			err := syscall.Flock(fd, syscall.LOCK_EX)
+			if err == syscall.EINTR {
+				continue
+			}
+			done <- err
+			return
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timeout:
+		return ErrBusy
+	}
+}
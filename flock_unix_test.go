@@ -0,0 +1,377 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lockfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flockPathEnv tells TestFlockHelperProcess which lockfile to lock.
+const flockPathEnv = "LOCKFILE_FLOCK_PATH"
+
+// TestFlockHelperProcess holds the lock of TestEmptyContent via WithEmptyContent until stdin is closed.
+func TestFlockHelperProcess(t *testing.T) {
+	path := os.Getenv(flockPathEnv)
+	if path == "" {
+		return
+	}
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Println("locked")
+	_, _ = io.Copy(ioutil.Discard, os.Stdin)
+	os.Exit(0)
+}
+
+func TestEmptyContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFlockHelperProcess$")
+	cmd.Env = append(os.Environ(), flockPathEnv+"="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("cannot read outcome: %v", err)
+	}
+	if outcome := strings.TrimSpace(line); outcome != "locked" {
+		t.Fatalf("helper failed to lock: %s", outcome)
+	}
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+
+	if locked, err := lf.IsLocked(); err != nil || !locked {
+		t.Fatalf("got IsLocked %v, %v, want true, <nil>", locked, err)
+	}
+
+	// The helper releases the lock by exiting.
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, err := lf.IsLocked(); err != nil || locked {
+		t.Fatalf("got IsLocked %v, %v after the helper exited, want false, <nil>", locked, err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ok, err := lf.LockedByMe(); err != nil || !ok {
+		t.Fatalf("got LockedByMe %v, %v, want true, <nil>", ok, err)
+	}
+
+	if size, err := lf.Size(); err != nil || size != 0 {
+		t.Fatalf("got size %d, %v, want 0, <nil>", size, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if locked, err := lf.IsLocked(); err != nil || locked {
+		t.Fatalf("got IsLocked %v, %v after Unlock, want false, <nil>", locked, err)
+	}
+}
+
+func TestEmptyContentTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := lf.TryLockEx("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if res.Kind != ReplacedEmpty {
+		t.Errorf("got kind %v, want %v", res.Kind, ReplacedEmpty)
+	}
+
+	if size, err := lf.Size(); err != nil || size != 0 {
+		t.Fatalf("got size %d, %v, want 0, <nil>", size, err)
+	}
+}
+
+func TestEmptyContentLockfileReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locks := 0
+	_, err = lf.acquireFlock(func(f *os.File) error {
+		locks++
+		if locks == 1 {
+			// the previous owner unlocks and someone else creates the lockfile anew
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+				return err
+			}
+		}
+		return flockTry(f)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if locks != 2 {
+		t.Fatalf("got %d locks, want 2", locks)
+	}
+
+	registry.Lock()
+	f := lf.st.flocked
+	registry.Unlock()
+
+	locked, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, err := os.Lstat(path); err != nil || !os.SameFile(locked, current) {
+		t.Fatalf("got lock of a removed lockfile, %v", err)
+	}
+}
+
+// startFlockHelper runs TestFlockHelperProcess holding the lock of path until the returned pipe is closed.
+func startFlockHelper(t *testing.T, path string) (release io.Closer, wait func() error) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFlockHelperProcess$")
+	cmd.Env = append(os.Environ(), flockPathEnv+"="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		_ = cmd.Wait()
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("cannot read outcome: %v", err)
+	}
+	if outcome := strings.TrimSpace(line); outcome != "locked" {
+		t.Fatalf("helper failed to lock: %s", outcome)
+	}
+
+	return stdin, cmd.Wait
+}
+
+func TestLockWithTimeoutExpires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	startFlockHelper(t, path)
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const timeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := lf.LockWithTimeout("main", timeout); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+	if waited := time.Since(start); waited < timeout || waited > 10*timeout {
+		t.Fatalf("waited %v, want about %v", waited, timeout)
+	}
+
+	if ok, err := lf.LockedByMe(); err != nil || ok {
+		t.Fatalf("got LockedByMe %v, %v, want false, <nil>", ok, err)
+	}
+}
+
+func TestLockWithTimeoutOnRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	release, wait := startFlockHelper(t, path)
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const delay = 50 * time.Millisecond
+	time.AfterFunc(delay, func() { release.Close() })
+
+	start := time.Now()
+	if err := lf.LockWithTimeout("main", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	// The helper releases the lock by exiting, which may take a while, so only check that we didn't poll.
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < delay || waited > 10*time.Second {
+		t.Fatalf("waited %v, want a bit more than %v", waited, delay)
+	}
+
+	if ok, err := lf.LockedByMe(); err != nil || !ok {
+		t.Fatalf("got LockedByMe %v, %v, want true, <nil>", ok, err)
+	}
+}
+
+func TestLockWithTimeoutRetried(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	release, wait := startFlockHelper(t, path)
+
+	lf, err := New(path, WithEmptyContent(), WithBackoff(ConstantBackoff{Delay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.LockWithTimeout("main", 10*time.Millisecond); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 3; i++ {
+		if err := lf.LockWithTimeout("main", 10*time.Millisecond); err != ErrBusy {
+			t.Fatalf("%d: expected error %v, got %v", i, ErrBusy, err)
+		}
+	}
+	if got := runtime.NumGoroutine(); got > goroutines {
+		t.Fatalf("got %d goroutines after retrying, want at most %d", got, goroutines)
+	}
+
+	release.Close()
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.LockWithTimeout("main", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStatusHandlerEmptyContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := func() int {
+		rec := httptest.NewRecorder()
+		lf.StatusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		return rec.Code
+	}
+
+	if got := code(); got != http.StatusNotFound {
+		t.Fatalf("free: got code %d, want %d", got, http.StatusNotFound)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := code(); got != http.StatusOK {
+		t.Fatalf("held by us: got code %d, want %d", got, http.StatusOK)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := code(); got != http.StatusNotFound {
+		t.Fatalf("released: got code %d, want %d", got, http.StatusNotFound)
+	}
+
+	startFlockHelper(t, path)
+	if got := code(); got != http.StatusConflict {
+		t.Fatalf("held by another process: got code %d, want %d", got, http.StatusConflict)
+	}
+}
+
+func TestUnlockWithEmptyContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := lf.Acquire("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.UnlockWith(tok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The flock has been released, so anyone else gets the lock.
+	other, err := New(path, WithEmptyContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package lockfile
+
+import "syscall"
+
+// fsTypes names the magic numbers of common filesystems as reported by statfs(2).
+var fsTypes = map[uint32]string{
+	0x9123683e: "btrfs",
+	0xef53:     "ext4", // also ext2 and ext3
+	0x65735546: "fuse",
+	0x6969:     "nfs",
+	0x794c7630: "overlayfs",
+	0x9fa0:     "proc",
+	0xff534d42: "cifs",
+	0x73717368: "squashfs",
+	0x01021994: "tmpfs",
+	0x58465342: "xfs",
+	0x2fc12fc1: "zfs",
+}
+
+// fsType returns the type of the filesystem containing dir or "", if it is unknown.
+func fsType(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+
+	return fsTypes[uint32(st.Type)]
+}
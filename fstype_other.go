@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package lockfile
+
+// fsType returns the type of the filesystem containing dir, which is unknown here.
+func fsType(dir string) string {
+	return ""
+}
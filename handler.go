@@ -0,0 +1,67 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// StatusHandler returns a handler for health checks, which writes the Status of the lockfile as JSON.
+// It responds with http.StatusOK, if we own the lock, http.StatusConflict, if another live process does,
+// and http.StatusNotFound, if the lock is free, including lockfiles of dead owners and invalid ones.
+// For WithEmptyContent, where the lockfile doesn't name its owner, the flock tells whether the lock is held,
+// see IsLocked. The pid is only reported then, if it is ours.
+// Failing to get the status is reported as http.StatusInternalServerError.
+func (l Lockfile) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, code, err := l.statusCode()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(status)
+	}
+}
+
+// statusCode returns the Status of the lockfile and the code StatusHandler responds with.
+func (l Lockfile) statusCode() (LockStatus, int, error) {
+	if l.options().emptyContent {
+		return l.flockStatus()
+	}
+
+	status, err := l.Status()
+	if err != nil && err != ErrInvalidPid {
+		return status, 0, err
+	}
+
+	switch {
+	case status.PID == 0 || !status.Alive:
+		return status, http.StatusNotFound, nil
+	case l.isMine(LockInfo{PID: status.PID, Hostname: status.Host}):
+		return status, http.StatusOK, nil
+	default:
+		return status, http.StatusConflict, nil
+	}
+}
+
+// flockStatus implements statusCode for WithEmptyContent.
+func (l Lockfile) flockStatus() (LockStatus, int, error) {
+	status := LockStatus{Path: l.name}
+	if l.st != nil && l.flockHeld() {
+		status.PID, status.Alive = l.options().pid, true
+		return status, http.StatusOK, nil
+	}
+
+	locked, err := l.IsLocked()
+	if err != nil {
+		return status, 0, err
+	}
+	if !locked {
+		return status, http.StatusNotFound, nil
+	}
+
+	status.Alive = true
+	return status, http.StatusConflict, nil
+}
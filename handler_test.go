@@ -0,0 +1,87 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	path, err := filepath.Abs("test_handler.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead := GetDeadPID()
+
+	tests := [...]struct {
+		setup func()
+		code  int
+		pid   int
+	}{
+		{
+			setup: func() {},
+			code:  http.StatusNotFound,
+		},
+		{
+			setup: func() {
+				if err := lf.TryLock("main"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			code: http.StatusOK,
+			pid:  os.Getpid(),
+		},
+		{
+			setup: func() { writeBusyLockfile(t, path) },
+			code:  http.StatusConflict,
+			pid:   os.Getppid(),
+		},
+		{
+			setup: func() {
+				if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", dead)), 0666); err != nil {
+					t.Fatal(err)
+				}
+			},
+			code: http.StatusNotFound,
+			pid:  dead,
+		},
+	}
+
+	for step, tc := range tests {
+		tc.setup()
+
+		rec := httptest.NewRecorder()
+		lf.StatusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+		if rec.Code != tc.code {
+			t.Errorf("%d: got code %d, want %d", step, rec.Code, tc.code)
+		}
+
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%d: got content type %q", step, got)
+		}
+
+		var body struct {
+			Path string `json:"path"`
+			PID  int    `json:"pid"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%d: invalid body %q: %v", step, rec.Body, err)
+		}
+		if body.Path != path || body.PID != tc.pid {
+			t.Errorf("%d: got body %q, want path %q and pid %d", step, rec.Body, path, tc.pid)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package lockfile
+
+import (
+	"github.com/shirou/gopsutil/v4/process"
+	"os"
+)
+
+// LockReplacing takes over the lock from the owner with pid expectedPID, even if it is still running.
+// If someone else owns the lock, ErrBusy is returned. This is meant for orchestrated handoffs,
+// where a successor is told the pid of its predecessor.
+// If there is no lockfile anymore, it is acquired like TryLock does.
+//
+// The lockfile is replaced atomically, so there is no moment without an owner.
+// Right before, it is checked to still be the file naming expectedPID, so a lockfile
+// of someone else, who reaped it meanwhile, is reported as ErrBusy instead of being replaced.
+// Checking and replacing are not atomic together though, so a tiny window remains.
+func (l Lockfile) LockReplacing(expectedPID int, expProcName string) (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if isGloballyDisabled() {
+		return nil
+	}
+
+	inspected, err := os.Lstat(l.name)
+	if os.IsNotExist(err) {
+		return l.TryLock(expProcName)
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := l.readInfo()
+	switch {
+	case os.IsNotExist(err):
+		return l.TryLock(expProcName)
+	case err != nil:
+		return err
+	case info.PID != expectedPID:
+		return ErrBusy
+	}
+
+	take := func() (CreationKind, error) {
+		return ReplacedOwn, l.replace(l.newInfo(), inspected)
+	}
+	if l.st == nil {
+		_, err := take()
+		return err
+	}
+
+	if _, err := l.track(take); err != nil {
+		return err
+	}
+
+	l.startLease()
+	return nil
+}
+
+// Adopt takes ownership of a lockfile already naming this process as its owner without rewriting it.
+// This happens after a process re-executes itself, e.g. for a live upgrade, as its pid stays the same.
+// Adopting registers the lock within this process like TryLock does.
+// expProcName must match the name of this process, so a different program doesn't adopt the lock by accident.
+// A lockfile of another owner is reported as ErrBusy.
+func (l Lockfile) Adopt(expProcName string) (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	info, err := l.readInfo()
+	if err != nil {
+		return err
+	}
+
+	if !l.isMine(info) {
+		return ErrBusy
+	}
+
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return err
+	}
+	name, err := proc.Name()
+	if err != nil {
+		return err
+	}
+	if !l.options().matchName(expProcName, name) {
+		return ErrBusy
+	}
+
+	if l.st != nil {
+		if ok, _ := reserve(l.name, l.st); !ok && l.options().registry {
+			return ErrBusy
+		}
+		hold(l.name, l.st)
+	}
+
+	return nil
+}
+
+// Transfer hands the lock we own over to the process childPID, usually a worker we forked,
+// by atomically rewriting the lockfile to name it as the owner.
+// Unlike the child acquiring the lock itself, there is no moment in which a third process might take it.
+// Our Unlock doesn't remove the lockfile anymore, but returns ErrTransferred, while it still names childPID.
+//
+// A lockfile we don't own is reported as ErrRogueDeletion.
+func (l Lockfile) Transfer(childPID int) (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if childPID <= 0 {
+		return ErrInvalidPid
+	}
+
+	info, err := l.readInfo()
+	switch {
+	case err == ErrInvalidPid, os.IsNotExist(err):
+		return ErrRogueDeletion
+	case err != nil:
+		return err
+	case !l.isMine(info):
+		return ErrRogueDeletion
+	case l.st != nil && replaced(l.name, l.st):
+		return ErrRogueDeletion
+	}
+
+	info.PID = childPID
+	if err := l.replace(info, nil); err != nil {
+		return err
+	}
+
+	if l.st != nil {
+		transfer(l.name, l.st, childPID)
+	}
+	l.record("transferred")
+
+	return nil
+}
+
+// MoveTo moves the lockfile we own to newPath and returns the Lockfile for it, which we own then.
+// This migrates a held lock to another directory without a moment where neither lockfile exists:
+// The lockfile is linked to newPath first and only removed from its old path afterwards.
+// Unlike os.Rename, this never replaces a lockfile already existing at newPath, but returns ErrBusy.
+//
+// The returned Lockfile is made by New with the options of l, so newPath is checked like New does.
+// The lock keeps its age and the lease given by WithLeaseDeadline, and is recorded as released from the old path
+// and acquired at newPath.
+//
+// A lockfile we don't own is reported as ErrRogueDeletion.
+// As hard links cannot cross filesystems, moving the lockfile to another one fails with ErrCrossDevice.
+func (l Lockfile) MoveTo(newPath string) (moved Lockfile, err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	moved, err = New(newPath, withOptionsOf(l.options()))
+	if err != nil {
+		return Lockfile{}, err
+	}
+	newPath = moved.name
+
+	info, err := l.readInfo()
+	switch {
+	case err == ErrInvalidPid, os.IsNotExist(err):
+		return Lockfile{}, ErrRogueDeletion
+	case err != nil:
+		return Lockfile{}, err
+	case !l.isMine(info):
+		return Lockfile{}, ErrRogueDeletion
+	case l.st != nil && replaced(l.name, l.st):
+		return Lockfile{}, ErrRogueDeletion
+	}
+
+	fs := l.fs()
+	if err := fs.Link(l.name, newPath); err != nil {
+		switch {
+		case os.IsExist(err):
+			return Lockfile{}, ErrBusy
+		case isCrossDevice(err):
+			return Lockfile{}, ErrCrossDevice
+		default:
+			return Lockfile{}, err
+		}
+	}
+
+	if err := fs.Remove(l.name); err != nil {
+		_ = fs.Remove(newPath)
+		return Lockfile{}, err
+	}
+
+	if l.st != nil {
+		since := heldSince(l.st)
+		release(l.name, l.st)
+		hold(moved.name, moved.st)
+		if since.IsZero() {
+			since = l.options().clock.Now()
+		}
+		touch(moved.st, since)
+		moved.recordDir()
+		moved.startLease()
+	}
+	l.record("released")
+	moved.record("acquired")
+
+	return moved, nil
+}
+
+// withOptionsOf makes New use the options o of another Lockfile.
+func withOptionsOf(o *options) Option {
+	return func(dst *options) {
+		*dst = *o
+	}
+}
+
+// replace atomically replaces the lockfile with one recording info.
+// If expected is not nil, the lockfile must still be that file right before it is replaced, otherwise ErrBusy is returned.
+// Someone might still replace it after that check, but before our rename.
+// If info names us, the new lockfile is logged as acquired to the state log, see WithStateLog.
+func (l Lockfile) replace(info LockInfo, expected os.FileInfo) error {
+	data, err := l.options().encoder.Encode(info)
+	if err != nil {
+		return err
+	}
+
+	tmplock, cleanup, err := l.makePidFile(data)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	if expected != nil {
+		current, err := os.Lstat(l.name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// Compare the modification times as well, as the inode of a reaped lockfile might be reused right away.
+		if err != nil || !sameInstance(expected, current) {
+			return ErrBusy
+		}
+	}
+
+	if err := l.fs().Rename(tmplock, l.name); err != nil {
+		return err
+	}
+
+	if info.PID == l.options().pid {
+		l.logState("acquired")
+	}
+
+	return nil
+}
@@ -0,0 +1,373 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLockReplacing(t *testing.T) {
+	path, err := filepath.Abs("test_handoff.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	if got := lf.LockReplacing(os.Getppid()+1, name); got != ErrBusy {
+		t.Fatalf("mismatch: expected error %q, got %v", ErrBusy, got)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || mine {
+		t.Fatalf("mismatch: got %v, %v, want false, <nil>", mine, err)
+	}
+
+	if err := lf.LockReplacing(os.Getppid(), name); err != nil {
+		t.Fatalf("match: unexpected error: %v", err)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("match: got %v, %v, want true, <nil>", mine, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.LockReplacing(os.Getppid(), name); err != nil {
+		t.Fatalf("missing: unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockReplacingTracked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+	history := filepath.Join(dir, "history")
+
+	lf, err := New(path, WithInProcessRegistry(), WithHistory(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	if err := lf.LockReplacing(os.Getppid(), name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if err := other.TryLock(name); err != ErrBusy {
+		t.Fatalf("expected error %q from another Lockfile of this process, got %v", ErrBusy, err)
+	}
+
+	content, err := ioutil.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), " acquired by pid ") {
+		t.Fatalf("got history %q, want the handoff recorded", content)
+	}
+}
+
+func TestReplaceChecksExpected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	inspected, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone reaps the lockfile and acquires the lock, before we replace it.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	writeBusyLockfile(t, path)
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.replace(lf.newInfo(), inspected); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+
+	if got, err := ioutil.ReadFile(path); err != nil || string(got) != string(want) {
+		t.Fatalf("got %q, %v, want the lockfile of the other owner %q", got, err, want)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	path, err := filepath.Abs("test_handoff.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as written by this process before it re-executed itself
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	lf, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Base(os.Args[0])
+	if err := lf.Adopt(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	other, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := other.TryLock(name); got != ErrBusy {
+		t.Fatalf("adopted lock: expected error %q, got %v", ErrBusy, got)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lockfile %q should be removed, got %v", path, err)
+	}
+}
+
+func TestAdoptForeign(t *testing.T) {
+	path, err := filepath.Abs("test_handoff.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lf.Adopt(name); got != ErrBusy {
+		t.Fatalf("expected error %q, got %v", ErrBusy, got)
+	}
+}
+
+func TestMoveTo(t *testing.T) {
+	path, err := filepath.Abs("test_handoff.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPath, err := filepath.Abs("test_handoff_moved.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	moved, err := lf.MoveTo(newPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(newPath)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("old lockfile still exists: %v", err)
+	}
+
+	if mine, err := moved.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+
+	if _, err := lf.MoveTo(newPath); err != ErrRogueDeletion {
+		t.Fatalf("moved again: expected error %q, got %v", ErrRogueDeletion, err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lf.MoveTo(newPath); err != ErrBusy {
+		t.Fatalf("existing target: expected error %q, got %v", ErrBusy, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moved.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMoveToRecreated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone removed our lockfile and another one with our pid took its place.
+	tmp := filepath.Join(dir, "recreated")
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lf.MoveTo(filepath.Join(dir, "moved.lck")); err != ErrRogueDeletion {
+		t.Fatalf("expected error %q, got %v", ErrRogueDeletion, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("recreated lockfile has been moved: %v", err)
+	}
+}
+
+func TestMoveToChecksPath(t *testing.T) {
+	dir := t.TempDir()
+	history := filepath.Join(dir, "history")
+
+	lf, err := New(filepath.Join(dir, "test.lck"), WithTruncatedName(), WithHistory(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := lf.MoveTo(filepath.Join(dir, strings.Repeat("x", 300)+LockfileExt))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer moved.Unlock()
+
+	if base := filepath.Base(moved.String()); len(base) > maxNameLen {
+		t.Fatalf("got name of %d bytes, want it truncated to at most %d", len(base), maxNameLen)
+	}
+	if mine, err := moved.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+
+	content, err := ioutil.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 3 || !strings.Contains(lines[1], " released ") || !strings.Contains(lines[2], moved.String()+" acquired ") {
+		t.Fatalf("got history %q, want the move recorded", content)
+	}
+}
+
+// crossDeviceFS is a filesystem pretending that all links cross filesystems.
+type crossDeviceFS struct {
+	osFS
+}
+
+func (crossDeviceFS) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EXDEV}
+}
+
+func TestMoveToCrossDevice(t *testing.T) {
+	path, err := filepath.Abs("test_handoff.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPath, err := filepath.Abs("test_handoff_moved.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, withFilesystem(crossDeviceFS{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if _, err := lf.MoveTo(newPath); err != ErrCrossDevice {
+		t.Fatalf("expected error %q, got %v", ErrCrossDevice, err)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our parent stands in for the child, as any live process will do.
+	child := os.Getppid()
+	if err := lf.Transfer(child); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(child) + "\n"; string(content) != want {
+		t.Fatalf("got content %q, want %q", content, want)
+	}
+
+	if err := lf.Unlock(); err != ErrTransferred {
+		t.Fatalf("expected error %q, got %v", ErrTransferred, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Unlock removed the transferred lockfile: %v", err)
+	}
+
+	if err := lf.Transfer(os.Getpid()); err != ErrRogueDeletion {
+		t.Fatalf("transferred: expected error %q, got %v", ErrRogueDeletion, err)
+	}
+}
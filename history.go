@@ -0,0 +1,90 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WithHistory appends a line to the file path each time the lock is acquired or released by this Lockfile,
+// so it is possible to tell afterwards, who held the lock when.
+// Failing to write the history doesn't affect locking, but is reported to the logger given by WithLogger.
+func WithHistory(path string) Option {
+	return func(o *options) {
+		o.historyPath = path
+	}
+}
+
+// WithHistoryRotation rotates the file given by WithHistory, before it grows beyond maxBytes.
+// The rotated files are suffixed ".1", ".2" and so on, newest first. Only keep of them are kept.
+func WithHistoryRotation(maxBytes int64, keep int) Option {
+	return func(o *options) {
+		o.historyMaxBytes = maxBytes
+		o.historyKeep = keep
+	}
+}
+
+// record appends event to the history, if WithHistory has been given, and to the state log of WithStateLog.
+func (l Lockfile) record(event string) {
+	l.logState(event)
+
+	path := l.options().historyPath
+	if path == "" {
+		return
+	}
+
+	line := fmt.Sprintf("%s %s %s by pid %d\n",
+		l.options().clock.Now().Format(time.RFC3339Nano), l.name, event, l.options().pid)
+	if err := l.appendHistory(path, line); err != nil {
+		l.warnf("lockfile: cannot write history %s: %v", path, err)
+	}
+}
+
+// appendHistory appends line to the history file path, rotating it first, if it would grow too large.
+func (l Lockfile) appendHistory(path, line string) error {
+	if max := l.options().historyMaxBytes; max > 0 {
+		fi, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err == nil && fi.Size() > 0 && fi.Size()+int64(len(line)) > max {
+			if err := rotate(path, l.options().historyKeep); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// rotate moves the file path to path.1, path.1 to path.2 and so on, dropping all beyond path.<keep>.
+func rotate(path string, keep int) error {
+	if keep <= 0 {
+		return os.Remove(path)
+	}
+
+	if err := os.Remove(path + "." + strconv.Itoa(keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := keep - 1; i >= 1; i-- {
+		err := os.Rename(path+"."+strconv.Itoa(i), path+"."+strconv.Itoa(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(path, path+".1")
+}
@@ -0,0 +1,84 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.lck")
+	history := filepath.Join(dir, "history.log")
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock), WithHistory(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := clock.Now().Format(time.RFC3339Nano)
+	want := fmt.Sprintf("%s %s acquired by pid %d\n%s %s released by pid %d\n", now, path, os.Getpid(), now, path, os.Getpid())
+	if string(got) != want {
+		t.Errorf("got history %q, want %q", got, want)
+	}
+}
+
+func TestWithHistoryRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.lck")
+	history := filepath.Join(dir, "history.log")
+
+	clock := newFakeClock()
+	line := fmt.Sprintf("%s %s released by pid %d\n", clock.Now().Format(time.RFC3339Nano), path, os.Getpid())
+	max := int64(2 * len(line))
+
+	lf, err := New(path, WithClock(clock), WithHistory(history), WithHistoryRotation(max, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 8 lines make 4 files of 2 lines each, but only 2 rotated ones are kept.
+	for i := 0; i < 4; i++ {
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatal(err)
+		}
+		if err := lf.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{history, history + ".1", history + ".2"} {
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if int64(len(content)) > max {
+			t.Errorf("%s: got %d bytes, want at most %d", name, len(content), max)
+		}
+		if n := strings.Count(string(content), "\n"); n != 2 {
+			t.Errorf("%s: got %d lines, want 2", name, n)
+		}
+	}
+
+	if _, err := os.Stat(history + ".3"); !os.IsNotExist(err) {
+		t.Errorf("too many history files kept: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Holders returns the pids of all live processes holding the lockfile.
+//
+// A lockfile shared between several holders lists one holder per line,
+// "reader=<pid>" for a shared holder and "writer=<pid>" for an exclusive one.
+// A bare pid, as written by TryLock, counts as a writer. A file mixing a writer
+// with readers is reported as it is: every live holder is returned, writers first,
+// since each of them keeps a new writer from acquiring the lock.
+// Other lines are ignored and dead holders are left out.
+// Lockfiles in any other format report their single owner.
+func (l Lockfile) Holders() ([]int, error) {
+	content, err := l.readLockfile()
+	if err != nil {
+		return nil, err
+	}
+
+	pids, err := scanHolders(content)
+	if err != nil {
+		// not a shared lockfile, but maybe one in the configured format
+		info, err := l.readInfo()
+		if err != nil {
+			return nil, err
+		}
+		pids = []int{info.PID}
+	}
+
+	live := make([]int, 0, len(pids))
+	for _, pid := range pids {
+		running, err := l.isRunning(pid)
+		if err != nil {
+			return nil, err
+		}
+
+		if running {
+			live = append(live, pid)
+		}
+	}
+
+	return live, nil
+}
+
+// scanHolders returns the pids of all holders listed in content, writers first.
+// Content without any holder is invalid.
+func scanHolders(content []byte) ([]int, error) {
+	var writers, readers []int
+	seen := map[int]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		kind, value := "writer", line
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			kind, value = line[:i], line[i+1:]
+		}
+
+		if kind != "writer" && kind != "reader" {
+			continue
+		}
+
+		pid, err := strconv.Atoi(value)
+		if err != nil || pid <= 0 || seen[pid] {
+			continue
+		}
+
+		seen[pid] = true
+		if kind == "writer" {
+			writers = append(writers, pid)
+		} else {
+			readers = append(readers, pid)
+		}
+	}
+
+	if len(writers)+len(readers) == 0 {
+		return nil, ErrInvalidPid
+	}
+
+	return append(writers, readers...), nil
+}
@@ -0,0 +1,91 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHolders(t *testing.T) {
+	path, err := filepath.Abs("test_holders.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self, parent, dead := os.Getpid(), os.Getppid(), GetDeadPID()
+	content := fmt.Sprintf("reader=%d\nwriter=%d\nreader=%d\ncomment\n", parent, self, dead)
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	got, err := lf.Holders()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []int{self, parent}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got holders %v, want %v", got, want)
+	}
+}
+
+func TestHoldersOfExclusiveLock(t *testing.T) {
+	path, err := filepath.Abs("test_holders.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	got, err := lf.Holders()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []int{os.Getpid()}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got holders %v, want %v", got, want)
+	}
+}
+
+func TestScanHolders(t *testing.T) {
+	tests := [...]struct {
+		input []byte
+		pids  []int
+		xfail error
+	}{
+		{xfail: ErrInvalidPid},
+		{input: []byte("\n"), xfail: ErrInvalidPid},
+		{input: []byte("reader=a\n"), xfail: ErrInvalidPid},
+		{input: []byte("1\n"), pids: []int{1}},
+		{input: []byte("reader=2\nwriter=1\nreader=2\n"), pids: []int{1, 2}},
+		{input: []byte("3\nreader=2\ntoken=7\n"), pids: []int{3, 2}},
+	}
+
+	for step, tc := range tests {
+		got, err := scanHolders(tc.input)
+		if err != tc.xfail {
+			t.Errorf("%d: expected error %v, got %v", step, tc.xfail, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tc.pids) {
+			t.Errorf("%d: expected pids %v, got %v", step, tc.pids, got)
+		}
+	}
+}
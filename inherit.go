@@ -0,0 +1,96 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AdoptFromEnv takes over a lock from a supervisor, which passed an open file descriptor of the lockfile
+// across exec and its number in the environment variable envVar.
+// The variable holds the number, optionally followed by a colon and the path of the lockfile.
+// Without the path, it is looked up via /proc/self/fd, which only works on Linux.
+//
+// The descriptor must still refer to the lockfile, otherwise ErrRogueDeletion is returned.
+// A lockfile naming the supervisor is rewritten to name this process, like LockReplacing does,
+// so the lock survives the supervisor. Unlock releases the lock and closes the descriptor.
+func AdoptFromEnv(envVar string, opts ...Option) (Lockfile, error) {
+	value := os.Getenv(envVar)
+	if strings.TrimSpace(value) == "" {
+		return Lockfile{}, fmt.Errorf("%w: environment variable %s is unset or empty", ErrEmptyPath, envVar)
+	}
+
+	number, path := value, ""
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		number, path = value[:i], value[i+1:]
+	}
+
+	fd, err := strconv.ParseUint(number, 10, 0)
+	if err != nil {
+		return Lockfile{}, fmt.Errorf("lockfile: environment variable %s holds no file descriptor: %q", envVar, value)
+	}
+
+	if path == "" {
+		path, err = os.Readlink("/proc/self/fd/" + number)
+		if err != nil {
+			return Lockfile{}, fmt.Errorf("lockfile: cannot tell the path of file descriptor %d: %w", fd, err)
+		}
+	}
+
+	l, err := New(path, opts...)
+	if err != nil {
+		return Lockfile{}, err
+	}
+
+	f := os.NewFile(uintptr(fd), path)
+	if err := l.adoptFile(f); err != nil {
+		_ = f.Close()
+		return Lockfile{}, l.wrapErr(err)
+	}
+
+	return l, nil
+}
+
+// adoptFile takes over the lock held via f, which is closed on release.
+func (l Lockfile) adoptFile(f *os.File) error {
+	inherited, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = l.track(func() (CreationKind, error) {
+		current, err := l.fs().Stat(l.name)
+		switch {
+		case os.IsNotExist(err):
+			return 0, ErrRogueDeletion
+		case err != nil:
+			return 0, err
+		case !os.SameFile(inherited, current):
+			return 0, ErrRogueDeletion
+		}
+
+		info, err := l.readInfo()
+		if err != nil {
+			return 0, err
+		}
+
+		if !l.isMine(info) {
+			if err := l.replace(l.newInfo(), current); err != nil {
+				return 0, err
+			}
+		}
+
+		return ReplacedOwn, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	registry.Lock()
+	l.st.inherited = f
+	registry.Unlock()
+
+	l.startLease()
+	return nil
+}
@@ -0,0 +1,145 @@
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris || aix
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris aix
+
+package lockfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// inheritFd opens path and returns the number of a descriptor for it, as if a supervisor passed it across exec.
+func inheritFd(t *testing.T, path string) int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A duplicate isn't closed by f, just like an inherited descriptor.
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd
+}
+
+func TestAdoptFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	writeBusyLockfile(t, path)
+
+	fd := inheritFd(t, path)
+	t.Setenv("TEST_LOCKFILE_FD", strconv.Itoa(fd)+":"+path)
+
+	lf, err := AdoptFromEnv("TEST_LOCKFILE_FD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected lockfile to be removed, got %v", err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != syscall.EBADF {
+		t.Fatalf("expected descriptor to be closed, got %v", err)
+	}
+}
+
+func TestAdoptFromEnvWithoutPath(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("no /proc/self/fd on this platform")
+	}
+
+	path := filepath.Join(t.TempDir(), "test.lck")
+	writeBusyLockfile(t, path)
+
+	t.Setenv("TEST_LOCKFILE_FD", strconv.Itoa(inheritFd(t, path)))
+
+	lf, err := AdoptFromEnv("TEST_LOCKFILE_FD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if lf.name != path {
+		t.Fatalf("got path %q, want %q", lf.name, path)
+	}
+}
+
+func TestAdoptFromEnvReplacedLockfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	writeBusyLockfile(t, path)
+
+	fd := inheritFd(t, path)
+	defer syscall.Close(fd)
+	t.Setenv("TEST_LOCKFILE_FD", strconv.Itoa(fd)+":"+path)
+
+	// Someone reaped the lockfile and acquired a new one meanwhile.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	writeBusyLockfile(t, path)
+
+	if _, err := AdoptFromEnv("TEST_LOCKFILE_FD"); err != ErrRogueDeletion {
+		t.Fatalf("expected error %q, got %v", ErrRogueDeletion, err)
+	}
+}
+
+func TestAdoptFromEnvInvalid(t *testing.T) {
+	for _, value := range []string{"", "x", "-1:/tmp/test.lck"} {
+		t.Setenv("TEST_LOCKFILE_FD", value)
+
+		if _, err := AdoptFromEnv("TEST_LOCKFILE_FD"); err == nil {
+			t.Errorf("%q: expected error, got none", value)
+		}
+	}
+}
+
+func TestAdoptFromEnvTracked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+	history := filepath.Join(dir, "history")
+	name := writeBusyLockfile(t, path)
+
+	fd := inheritFd(t, path)
+	t.Setenv("TEST_LOCKFILE_FD", strconv.Itoa(fd)+":"+path)
+
+	lf, err := AdoptFromEnv("TEST_LOCKFILE_FD", WithInProcessRegistry(), WithHistory(history))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	other, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TryLock(name); err != ErrBusy {
+		t.Fatalf("expected error %q from another Lockfile of this process, got %v", ErrBusy, err)
+	}
+
+	content, err := ioutil.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), " acquired by pid ") {
+		t.Fatalf("got history %q, want the adoption recorded", content)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris || aix
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris aix
+
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the inode number of the file described by fi or 0, if it is unknown.
+func inode(fi os.FileInfo) uint64 {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return uint64(st.Ino)
+}
+
+// inodeOf returns the inode number of the file name or 0, if it is unknown.
+func inodeOf(name string) uint64 {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return 0
+	}
+
+	return inode(fi)
+}
+
+// linkCount returns the number of hard links to the file described by fi and whether it is known.
+func linkCount(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(st.Nlink), true
+}
+
+// device returns the number of the device containing the file described by fi and whether it is known.
+func device(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(st.Dev), true
+}
@@ -0,0 +1,44 @@
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns 0, as os.FileInfo doesn't tell the file index, which tells files apart like an inode number.
+func inode(fi os.FileInfo) uint64 {
+	return 0
+}
+
+// inodeOf returns the file index of the file name, which tells files apart like an inode number, or 0, if it is unknown.
+func inodeOf(name string) uint64 {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0
+	}
+
+	// Opened for its attributes only, so others may still replace or remove it meanwhile.
+	share := uint32(syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE)
+	h, err := syscall.CreateFile(p, 0, share, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return 0
+	}
+	defer syscall.CloseHandle(h)
+
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &d); err != nil {
+		return 0
+	}
+
+	return uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow)
+}
+
+// linkCount reports the number of hard links to be unknown, as os.FileInfo doesn't tell it.
+func linkCount(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// device reports the device to be unknown, as os.FileInfo doesn't tell it.
+func device(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,152 @@
+package lockfile
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// WithIOTimeout bounds opening and reading the lockfile, creating its temporary files and linking, renaming
+// and removing them by d. An operation taking longer, e.g. on a stuck NFS server, fails with ErrIOTimeout,
+// which Lock retries. This is independent of WithProcessCheckTimeout.
+// Other operations aren't bounded, like checking the lockfile via lstat(2) before reading it,
+// writing the content of its temporary files and changing its times in Refresh.
+// The operation cannot be canceled, so it may still complete in the background.
+// Files it opens or creates then are closed and removed once it does, as is a lockfile it links.
+func WithIOTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.ioTimeout = d
+	}
+}
+
+// timeoutFS fails operations of fs, which take longer than timeout, with ErrIOTimeout.
+type timeoutFS struct {
+	fs      filesystem
+	timeout time.Duration
+}
+
+// ioResult is the outcome of an operation of timeoutFS.
+type ioResult struct {
+	r   io.ReadCloser
+	f   *os.File
+	fi  os.FileInfo
+	n   int
+	err error
+}
+
+// run runs op, giving up on it after timeout. A ioResult arriving too late is passed to late, if not nil.
+func (t timeoutFS) run(op func() ioResult, late func(ioResult)) ioResult {
+	// buffered, so the operation can finish after we gave up on it
+	done := make(chan ioResult, 1)
+	go func() {
+		done <- op()
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res
+	case <-timer.C:
+		if late != nil {
+			go func() {
+				late(<-done)
+			}()
+		}
+		return ioResult{err: ErrIOTimeout}
+	}
+}
+
+func (t timeoutFS) Open(name string) (io.ReadCloser, error) {
+	res := t.run(func() ioResult {
+		r, err := t.fs.Open(name)
+		return ioResult{r: r, err: err}
+	}, func(res ioResult) {
+		if res.err == nil {
+			_ = res.r.Close()
+		}
+	})
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	return timeoutReader{r: res.r, fs: t}, nil
+}
+
+func (t timeoutFS) TempFile(dir, pattern string) (*os.File, error) {
+	res := t.run(func() ioResult {
+		f, err := t.fs.TempFile(dir, pattern)
+		return ioResult{f: f, err: err}
+	}, func(res ioResult) {
+		if res.err == nil {
+			_ = res.f.Close()
+			_ = t.fs.Remove(res.f.Name())
+		}
+	})
+
+	return res.f, res.err
+}
+
+func (t timeoutFS) Link(oldname, newname string) error {
+	return t.run(func() ioResult {
+		// Remember the temporary file, as it is removed, once we gave up on linking it.
+		fi, err := t.fs.Stat(oldname)
+		if err != nil {
+			return ioResult{err: err}
+		}
+		return ioResult{fi: fi, err: t.fs.Link(oldname, newname)}
+	}, func(res ioResult) {
+		if res.err != nil {
+			return
+		}
+		// Nobody holds the lock we got too late, unless someone replaced the lockfile meanwhile.
+		if current, err := t.fs.Stat(newname); err == nil && os.SameFile(res.fi, current) {
+			_ = t.fs.Remove(newname)
+		}
+	}).err
+}
+
+func (t timeoutFS) Remove(name string) error {
+	return t.run(func() ioResult {
+		return ioResult{err: t.fs.Remove(name)}
+	}, nil).err
+}
+
+func (t timeoutFS) Rename(oldname, newname string) error {
+	return t.run(func() ioResult {
+		return ioResult{err: t.fs.Rename(oldname, newname)}
+	}, nil).err
+}
+
+func (t timeoutFS) Stat(name string) (os.FileInfo, error) {
+	res := t.run(func() ioResult {
+		fi, err := t.fs.Stat(name)
+		return ioResult{fi: fi, err: err}
+	}, nil)
+
+	return res.fi, res.err
+}
+
+// timeoutReader bounds each read of r like timeoutFS does.
+type timeoutReader struct {
+	r  io.ReadCloser
+	fs timeoutFS
+}
+
+func (t timeoutReader) Read(p []byte) (int, error) {
+	// A read finishing late must not write to p anymore, as it belongs to the caller again.
+	buf := make([]byte, len(p))
+	res := t.fs.run(func() ioResult {
+		n, err := t.r.Read(buf)
+		return ioResult{n: n, err: err}
+	}, nil)
+
+	return copy(p, buf[:res.n]), res.err
+}
+
+func (t timeoutReader) Close() error {
+	return t.fs.run(func() ioResult {
+		return ioResult{err: t.r.Close()}
+	}, nil).err
+}
@@ -0,0 +1,169 @@
+package lockfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowFS delays all operations like a stuck NFS server.
+type slowFS struct {
+	osFS
+	delay time.Duration
+}
+
+func (fs slowFS) Open(name string) (io.ReadCloser, error) {
+	time.Sleep(fs.delay)
+	return fs.osFS.Open(name)
+}
+
+func (fs slowFS) TempFile(dir, pattern string) (*os.File, error) {
+	time.Sleep(fs.delay)
+	return fs.osFS.TempFile(dir, pattern)
+}
+
+func (fs slowFS) Link(oldname, newname string) error {
+	time.Sleep(fs.delay)
+	return fs.osFS.Link(oldname, newname)
+}
+
+func (fs slowFS) Remove(name string) error {
+	time.Sleep(fs.delay)
+	return fs.osFS.Remove(name)
+}
+
+func TestIOTimeout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	const delay = 200 * time.Millisecond
+	lf, err := New(path, withFilesystem(slowFS{delay: delay}), WithIOTimeout(delay/10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := lf.TryLock("main"); !errors.Is(err, ErrIOTimeout) {
+		t.Fatalf("expected error %q, got %v", ErrIOTimeout, err)
+	}
+	if waited := time.Since(start); waited >= delay {
+		t.Fatalf("waited %v for an operation taking %v", waited, delay)
+	}
+
+	// The temporary file created in the background is removed once that is done.
+	deadline := time.Now().Add(50 * delay)
+	for {
+		names, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d files left behind", len(names))
+		}
+		time.Sleep(delay / 10)
+	}
+}
+
+// slowLinkFS delays the outcome of linking only, like a server answering late,
+// so the lockfile is created, but we give up on it. It tells via linked, once it answers.
+type slowLinkFS struct {
+	osFS
+	delay  time.Duration
+	linked chan error
+}
+
+func (fs slowLinkFS) Link(oldname, newname string) error {
+	err := fs.osFS.Link(oldname, newname)
+	time.Sleep(fs.delay)
+	fs.linked <- err
+	return err
+}
+
+func TestIOTimeoutLateLink(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	const delay = 200 * time.Millisecond
+	linked := make(chan error, 1)
+	lf, err := New(path, withFilesystem(slowLinkFS{delay: delay, linked: linked}), WithIOTimeout(delay/10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); !errors.Is(err, ErrIOTimeout) {
+		t.Fatalf("expected error %q, got %v", ErrIOTimeout, err)
+	}
+	if err := <-linked; err != nil {
+		t.Fatalf("unexpected error linking in the background: %v", err)
+	}
+
+	// The lockfile linked in the background is removed once that is done, as nobody holds it.
+	deadline := time.Now().Add(50 * delay)
+	for {
+		names, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d files left behind", len(names))
+		}
+		time.Sleep(delay / 10)
+	}
+}
+
+func TestIOTimeoutFast(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithIOTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, err := lf.LockedByMe(); err != nil || !ok {
+		t.Fatalf("got LockedByMe %v, %v, want true, <nil>", ok, err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// stuckReader blocks reading until unblock is closed.
+type stuckReader struct {
+	unblock chan struct{}
+}
+
+func (r stuckReader) Read(p []byte) (int, error) {
+	<-r.unblock
+	return copy(p, "42\n"), io.EOF
+}
+
+func (r stuckReader) Close() error { return nil }
+
+func TestIOTimeoutRead(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	r := timeoutReader{r: stuckReader{unblock: unblock}, fs: timeoutFS{timeout: 10 * time.Millisecond}}
+	if _, err := ioutil.ReadAll(r); err != ErrIOTimeout {
+		t.Fatalf("expected error %q, got %v", ErrIOTimeout, err)
+	}
+
+	fast := timeoutReader{r: ioutil.NopCloser(strings.NewReader("42\n")), fs: timeoutFS{timeout: time.Minute}}
+	if content, err := ioutil.ReadAll(fast); err != nil || string(content) != "42\n" {
+		t.Fatalf("got %q, %v, want %q, <nil>", content, err, "42\n")
+	}
+}
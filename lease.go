@@ -0,0 +1,100 @@
+package lockfile
+
+import (
+	"os"
+	"time"
+)
+
+// WithLeaseDeadline releases the lock in the background, if Refresh hasn't been called for d since the lock
+// has been acquired or last refreshed. A process, which hangs without exiting, keeps the lock forever otherwise,
+// as its pid stays alive. Callers must call Refresh more often than d, while they still make progress.
+// Errors of releasing the lock are passed to the handler given by WithUnlockErrorHandler, like for LockUntilClosed.
+func WithLeaseDeadline(d time.Duration) Option {
+	return func(o *options) {
+		o.leaseDeadline = d
+	}
+}
+
+// startLease starts watching the lease of the lock just acquired, see WithLeaseDeadline.
+func (l Lockfile) startLease() {
+	d := l.options().leaseDeadline
+	if l.st == nil || d <= 0 {
+		return
+	}
+
+	clock := l.options().clock
+	stop := make(chan struct{})
+
+	registry.Lock()
+	if l.st.leaseStop != nil {
+		close(l.st.leaseStop)
+	}
+	l.st.leaseStop = stop
+	l.st.renewed = clock.Now()
+	registry.Unlock()
+
+	go func() {
+		wait := d
+		for {
+			select {
+			case <-stop:
+				return
+			case <-clock.After(wait):
+			}
+
+			leased, wait := l.expireLease(stop, d)
+			if wait > 0 {
+				continue
+			}
+			if leased == nil {
+				return
+			}
+
+			l.warnf("lockfile: %s has not been refreshed for %v, releasing it", l.name, d)
+			if err := l.unlock(leased); err != nil {
+				if handle := l.options().unlockErrorHandler; handle != nil {
+					handle(err)
+				}
+			}
+			return
+		}
+	}()
+}
+
+// leasedLock is the lock held, when its lease expired, see expireLease.
+type leasedLock struct {
+	file    os.FileInfo
+	flocked *os.File
+}
+
+// expireLease returns how long the lease watched via stop still lasts, if at all.
+// Otherwise it ends the lease and returns the lock held, or nil, if the lease has ended already,
+// as the lock has been released meanwhile. Both happen at once, so unlock can tell the lock
+// the lease ended for from one acquired anew, while the lease watcher was about to release it.
+func (l Lockfile) expireLease(stop chan struct{}, d time.Duration) (*leasedLock, time.Duration) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if l.st.leaseStop != stop {
+		return nil, 0
+	}
+
+	if wait := l.st.renewed.Add(d).Sub(l.options().clock.Now()); wait > 0 {
+		return nil, wait
+	}
+
+	l.st.leaseStop = nil
+	return &leasedLock{file: l.st.file, flocked: l.st.flocked}, 0
+}
+
+// renewLease records that the lock has just been refreshed, see WithLeaseDeadline.
+func (l Lockfile) renewLease() {
+	if l.st == nil {
+		return
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	l.st.renewed = l.options().clock.Now()
+}
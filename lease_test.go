@@ -0,0 +1,120 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaseDeadline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	const deadline = 100 * time.Millisecond
+	clock := newManualClock()
+	lf, err := New(path, WithLeaseDeadline(deadline), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Refreshing in time keeps the lock.
+	for i := 0; i < 6; i++ {
+		clock.awaitTimer()
+		clock.advance(deadline / 4)
+		if err := lf.Refresh(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+	}
+
+	clock.awaitTimer()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("lock released before the deadline: %v", err)
+	}
+
+	// Skipping refreshes releases it.
+	clock.advance(deadline)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("lock hasn't been released after skipping refreshes")
+		}
+	}
+
+	for _, held := range HeldByThisProcess() {
+		if held == path {
+			t.Fatalf("still holding %s", path)
+		}
+	}
+}
+
+func TestLeaseDeadlineStopsOnUnlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	const deadline = 50 * time.Millisecond
+	lf, err := New(path, WithLeaseDeadline(deadline), WithClock(newManualClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry.Lock()
+	stop := lf.st.leaseStop
+	registry.Unlock()
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A lock acquired anew afterwards must not be released by the old lease.
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if leased, _ := lf.expireLease(stop, 0); leased != nil {
+		t.Fatal("old lease ended the lease of the lock acquired anew")
+	}
+}
+
+func TestLeaseReleasesOnlyLeasedLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry.Lock()
+	leased := &leasedLock{file: lf.st.file}
+	registry.Unlock()
+
+	// Released and acquired anew, while the lease watcher was about to release it.
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if err := lf.unlock(leased); err != ErrRogueDeletion {
+		t.Fatalf("expected error %v, got %v", ErrRogueDeletion, err)
+	}
+
+	if ok, err := lf.LockedByMe(); err != nil || !ok {
+		t.Fatalf("got LockedByMe %v, %v, want true, <nil>", ok, err)
+	}
+}
@@ -0,0 +1,29 @@
+package lockfile
+
+// LockUntilClosed works like TryLock, but releases the lock once done is closed.
+// This ties the lock to the lifetime of a worker, like a slot of a pool held while the worker runs.
+// As nobody waits for the release, its errors are passed to the handler given by WithUnlockErrorHandler
+// and dropped without one.
+func (l Lockfile) LockUntilClosed(procName string, done <-chan struct{}) error {
+	if err := l.TryLock(procName); err != nil {
+		return err
+	}
+
+	go func() {
+		<-done
+		if err := l.Unlock(); err != nil {
+			if handle := l.options().unlockErrorHandler; handle != nil {
+				handle(err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// WithUnlockErrorHandler passes errors of releasing a lock in the background, like by LockUntilClosed, to handle.
+func WithUnlockErrorHandler(handle func(error)) Option {
+	return func(o *options) {
+		o.unlockErrorHandler = handle
+	}
+}
@@ -0,0 +1,86 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForRemoval waits up to a second for path to be removed.
+func waitForRemoval(t *testing.T, path string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+	}
+
+	t.Fatalf("%s has not been removed", path)
+}
+
+func TestLockUntilClosed(t *testing.T) {
+	path, err := filepath.Abs("test_lifetime.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	if err := lf.LockUntilClosed("main", done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if owner, err := lf.GetOwner(); err != nil || owner.Pid != os.Getpid() {
+		t.Fatalf("expected to own the lock, got %v, %v", owner, err)
+	}
+
+	close(done)
+	waitForRemoval(t, path)
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("released: unexpected error: %v", err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockUntilClosedReportsUnlockError(t *testing.T) {
+	path, err := filepath.Abs("test_lifetime.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	errs := make(chan error, 1)
+	lf, err := New(path, WithUnlockErrorHandler(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	if err := lf.LockUntilClosed("main", done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+
+	select {
+	case err := <-errs:
+		if err != ErrRogueDeletion {
+			t.Fatalf("expected error %q, got %v", ErrRogueDeletion, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unlock error has not been reported")
+	}
+}
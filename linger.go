@@ -0,0 +1,157 @@
+package lockfile
+
+import (
+	"os"
+	"time"
+)
+
+// WithUnlockDelay makes Unlock leave the lockfile in place for d before removing it.
+// A TryLock of the same Lockfile within d takes it back as it is, instead of writing it anew,
+// which saves the filesystem from churn by bursts of short locks.
+// Meanwhile, other processes still find the lock held by us.
+// If this process exits within d, the lockfile is reaped like the one of any dead owner.
+// Errors of removing the lockfile later are passed to the handler given by WithUnlockErrorHandler.
+func WithUnlockDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.unlockDelay = d
+	}
+}
+
+// linger implements Unlock with WithUnlockDelay, giving up the lock, but leaving its lockfile in place for now.
+func (l Lockfile) linger() {
+	registry.Lock()
+	file := l.st.file
+	registry.Unlock()
+
+	release(l.name, l.st)
+
+	stop := make(chan struct{})
+	registry.Lock()
+	l.st.lingering = stop
+	l.st.lingerFile = file
+	registry.Unlock()
+
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-l.options().clock.After(l.options().unlockDelay):
+		}
+
+		if err := l.removeLingering(stop); err != nil {
+			if handle := l.options().unlockErrorHandler; handle != nil {
+				handle(err)
+			}
+		}
+	}()
+}
+
+// removeLingering removes the lockfile left in place by linger, unless it has been taken back meanwhile.
+// A lockfile replaced by someone else is left alone.
+func (l Lockfile) removeLingering(stop chan struct{}) error {
+	registry.Lock()
+	current, file := l.st.lingering == stop, l.st.lingerFile
+	registry.Unlock()
+	if !current {
+		return nil
+	}
+
+	fi, err := os.Lstat(l.name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// It may have been taken back meanwhile. If not, keep readopt waiting until the lockfile is gone.
+	done := make(chan struct{})
+	defer close(done)
+
+	registry.Lock()
+	current = l.st.lingering == stop
+	if current {
+		l.st.lingering = nil
+		l.st.unlinger = done
+	}
+	registry.Unlock()
+	if !current {
+		return nil
+	}
+
+	defer func() {
+		registry.Lock()
+		if l.st.unlinger == done {
+			l.st.unlinger = nil
+		}
+		registry.Unlock()
+	}()
+
+	if err != nil || file != nil && !sameInstance(file, fi) {
+		// gone already or replaced by someone else
+		return nil
+	}
+
+	_ = l.fs().Remove(renewalsName(l.name))
+	if err := l.fs().Remove(l.name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// lingers reports whether Unlock left the lockfile in place for now, see WithUnlockDelay.
+func (l Lockfile) lingers() bool {
+	if l.st == nil {
+		return false
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	return l.st.lingering != nil
+}
+
+// readopt takes back the lockfile left in place by linger, if it is still ours and already has the content of li.
+// Either way, the lockfile is not removed later anymore.
+func (l Lockfile) readopt(li LockInfo) bool {
+	registry.Lock()
+	stop, file, unlinger := l.st.lingering, l.st.lingerFile, l.st.unlinger
+	if stop != nil {
+		close(stop)
+		l.st.lingering = nil
+	}
+	registry.Unlock()
+
+	if unlinger != nil {
+		<-unlinger
+	}
+
+	if stop == nil || file == nil {
+		return false
+	}
+	if current, err := os.Lstat(l.name); err != nil || !sameInstance(file, current) {
+		return false
+	}
+
+	want, err := l.options().encoder.Encode(li)
+	if err != nil {
+		return false
+	}
+	content, err := l.readLockfile()
+	if err != nil || string(content) != string(want) {
+		return false
+	}
+
+	hold(l.name, l.st)
+	return true
+}
+
+// reuseInfo returns li on the first call, as it has been taken from info already, and calls info afterwards.
+func reuseInfo(li LockInfo, info func() (LockInfo, error)) func() (LockInfo, error) {
+	used := false
+	return func() (LockInfo, error) {
+		if used {
+			return info()
+		}
+		used = true
+		return li, nil
+	}
+}
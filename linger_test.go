@@ -0,0 +1,131 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnlockDelayReadopts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	const delay = 200 * time.Millisecond
+	lf, err := New(path, WithUnlockDelay(delay))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	before, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatalf("lockfile removed right away: %v", err)
+	}
+	if ok, err := lf.LockedByMe(); err != nil || ok {
+		t.Fatalf("got LockedByMe %v, %v after Unlock, want false, <nil>", ok, err)
+	}
+
+	res, err := lf.TryLockEx("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Kind != ReplacedOwn {
+		t.Errorf("got kind %v, want %v", res.Kind, ReplacedOwn)
+	}
+
+	after, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameInstance(before, after) {
+		t.Fatal("lockfile has been written anew")
+	}
+
+	// Still held after the delay of the first Unlock.
+	time.Sleep(2 * delay)
+	if ok, err := lf.LockedByMe(); err != nil || !ok {
+		t.Fatalf("got LockedByMe %v, %v, want true, <nil>", ok, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	for {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Since(start) > 50*delay {
+			t.Fatal("lockfile hasn't been removed after the delay")
+		}
+		time.Sleep(delay / 10)
+	}
+}
+
+func TestUnlockDelayRewritesOtherContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithUnlockDelay(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.TryLockWithReason("main", "migration"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer lf.Unlock()
+
+	if reason, err := lf.Reason(); err != nil || reason != "migration" {
+		t.Fatalf("got reason %q, %v, want %q, <nil>", reason, err, "migration")
+	}
+}
+
+func TestRemoveLingeringTakenBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithUnlockDelay(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry.Lock()
+	stop := lf.st.lingering
+	registry.Unlock()
+
+	// Taken back, while the delay is just over.
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := lf.removeLingering(stop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ok, err := lf.LockedByMe(); err != nil || !ok {
+		t.Fatalf("got LockedByMe %v, %v, want true, <nil>", ok, err)
+	}
+}
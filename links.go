@@ -0,0 +1,36 @@
+package lockfile
+
+import "os"
+
+// WithVerifyLinkCount makes TryLock, Refresh and Unlock refuse to trust or remove a lockfile with more than one hard link,
+// returning ErrSuspiciousLinks instead. Someone could link the lockfile elsewhere to keep its content around after we removed it,
+// or link a file of their own into place to confuse who owns the lock.
+// This is meant for hardened deployments, where untrusted users can write to the directory of the lockfile.
+//
+// Only platforms telling the number of links, like Linux, the BSDs and macOS, check it. Windows doesn't.
+func WithVerifyLinkCount() Option {
+	return func(o *options) {
+		o.verifyLinkCount = true
+	}
+}
+
+// checkLinks returns ErrSuspiciousLinks, if the lockfile has more than one hard link and WithVerifyLinkCount is given.
+func (l Lockfile) checkLinks() error {
+	if !l.options().verifyLinkCount {
+		return nil
+	}
+
+	fi, err := os.Lstat(l.name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if n, ok := linkCount(fi); ok && n > 1 {
+		return ErrSuspiciousLinks
+	}
+
+	return nil
+}
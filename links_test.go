@@ -0,0 +1,86 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// linkLockfile links the lockfile at path to another name and skips the test, if links cannot be counted.
+func linkLockfile(t *testing.T, path string) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := linkCount(fi); !ok {
+		t.Skip("no link count on this platform")
+	}
+
+	if err := os.Link(path, path+".link"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyLinkCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithVerifyLinkCount())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	linkLockfile(t, path)
+
+	if err := lf.Refresh(); err != ErrSuspiciousLinks {
+		t.Errorf("Refresh: expected error %v, got %v", ErrSuspiciousLinks, err)
+	}
+
+	if err := lf.Unlock(); err != ErrSuspiciousLinks {
+		t.Errorf("Unlock: expected error %v, got %v", ErrSuspiciousLinks, err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("lockfile has been removed: %v", err)
+	}
+
+	if err := os.Remove(path + ".link"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyLinkCountBeforeReaping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	content := fmt.Sprintf("%d\n", GetDeadPID())
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	linkLockfile(t, path)
+
+	lf, err := New(path, WithVerifyLinkCount())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != ErrSuspiciousLinks {
+		t.Fatalf("expected error %v, got %v", ErrSuspiciousLinks, err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Fatalf("got content %q, want %q", got, content)
+	}
+}
@@ -0,0 +1,58 @@
+package lockfile
+
+import (
+	"sync"
+	"time"
+)
+
+// livenessCache remembers which processes have recently been found running.
+type livenessCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	running map[int]time.Time // pid to when it has been found running
+}
+
+// WithLivenessCacheTTL reuses the finding, that a process is running, for d instead of checking again.
+// This saves the liveness checks of Lock polling a lockfile of the same owner under heavy contention.
+// As a dead owner is never cached, no lock is reaped based on an outdated finding.
+// A lock is only reported busy for up to d after its owner exited.
+// Use d = 0, the default, to check every time.
+func WithLivenessCacheTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.livenessCache = nil
+		if d > 0 {
+			o.livenessCache = &livenessCache{ttl: d, running: map[int]time.Time{}}
+		}
+	}
+}
+
+// cachedRunning reports whether pid has been found running within the TTL of the cache.
+func (c *livenessCache) cachedRunning(pid int, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen, ok := c.running[pid]
+	if !ok {
+		return false
+	}
+
+	if now.Sub(seen) >= c.ttl {
+		delete(c.running, pid)
+		return false
+	}
+
+	return true
+}
+
+// store records whether pid has been found running at now.
+func (c *livenessCache) store(pid int, running bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if running {
+		c.running[pid] = now
+	} else {
+		delete(c.running, pid)
+	}
+}
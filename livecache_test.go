@@ -0,0 +1,86 @@
+package lockfile
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithLivenessCacheTTL(t *testing.T) {
+	path, err := filepath.Abs("test_livecache.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	running := true
+	check := func(pid int) (bool, error) {
+		calls++
+		return running, nil
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock), WithLivenessChecker(check), WithLivenessCacheTTL(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [...]struct {
+		advance time.Duration
+		running bool // as reported by the checker
+		want    bool
+		calls   int
+	}{
+		{running: true, want: true, calls: 1},
+		{advance: 500 * time.Millisecond, running: true, want: true, calls: 1},
+		{advance: 400 * time.Millisecond, running: false, want: true, calls: 1},
+		{advance: 100 * time.Millisecond, running: false, want: false, calls: 2},
+		// dead owners are never cached
+		{running: false, want: false, calls: 3},
+		{running: true, want: true, calls: 4},
+	}
+
+	for step, tc := range tests {
+		clock.advance(tc.advance)
+		running = tc.running
+
+		got, err := lf.isRunning(42)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+		if got != tc.want {
+			t.Errorf("%d: expected running %v, got %v", step, tc.want, got)
+		}
+		if calls != tc.calls {
+			t.Errorf("%d: expected %d calls of the checker, got %d", step, tc.calls, calls)
+		}
+	}
+}
+
+func TestWithLivenessCacheTTLDisabled(t *testing.T) {
+	path, err := filepath.Abs("test_livecache.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	check := func(pid int) (bool, error) {
+		calls++
+		return true, nil
+	}
+
+	lf, err := New(path, WithLivenessChecker(check), WithLivenessCacheTTL(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := lf.isRunning(42); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 3 {
+		t.Fatalf("expected 3 calls of the checker, got %d", calls)
+	}
+}
@@ -0,0 +1,14 @@
+package lockfile
+
+import "context"
+
+// Locker is the locking implemented by Lockfile.
+// Depend on it instead of Lockfile to replace the locking in tests, e.g. by lockfiletest.FakeLocker.
+type Locker interface {
+	TryLock(expProcName string) error
+	Lock(ctx context.Context, expProcName string) error
+	LockedByMe() (bool, error)
+	Unlock() error
+}
+
+var _ Locker = Lockfile{}
@@ -7,9 +7,9 @@
 package lockfile
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"github.com/shirou/gopsutil/v4/process"
 	"io"
 	"io/ioutil"
 	"os"
@@ -18,13 +18,35 @@ import (
 )
 
 // Lockfile is a pid file which can be locked
-type Lockfile string
+//
+// Don't compare Lockfiles via == or use them as map keys,
+// as copies of one compare equal, but other Lockfiles for the same path don't.
+// Use Equal and Key instead.
+type Lockfile struct {
+	name string
+	opts *options
+	st   *state
+}
 
 // TemporaryError is a type of error where a retry after a random amount of sleep should help to mitigate it.
 type TemporaryError string
 
 func (t TemporaryError) Error() string { return string(t) }
 
+// PathError records the lockfile an error happened with, see WithPathInErrors.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string { return fmt.Sprintf("lockfile %q: %v", e.Path, e.Err) }
+
+// Unwrap returns the error, which happened, so errors.Is works with PathError.
+func (e *PathError) Unwrap() error { return e.Err }
+
+// Temporary reports whether the error, which happened, is a temporary one.
+func (e *PathError) Temporary() bool { return isTemporary(e.Err) }
+
 // Temporary returns always true.
 // It exists, so you can detect it via
 //
@@ -35,62 +57,363 @@ func (t TemporaryError) Temporary() bool { return true }
 
 // Various errors returned by this package
 var (
-	ErrBusy          = TemporaryError("Locked by other process")             // If you get this, retry after a short sleep might help
-	ErrNotExist      = TemporaryError("Lockfile created, but doesn't exist") // If you get this, retry after a short sleep might help
-	ErrNeedAbsPath   = errors.New("Lockfiles must be given as absolute path names")
-	ErrInvalidPid    = errors.New("Lockfile contains invalid pid for system")
-	ErrDeadOwner     = errors.New("Lockfile contains pid of process not existent on this system anymore")
-	ErrRogueDeletion = errors.New("Lockfile owned by me has been removed unexpectedly")
+	ErrBusy              = TemporaryError("Locked by other process")             // If you get this, retry after a short sleep might help
+	ErrNotExist          = TemporaryError("Lockfile created, but doesn't exist") // If you get this, retry after a short sleep might help
+	ErrNeedAbsPath       = errors.New("Lockfiles must be given as absolute path names")
+	ErrInvalidPid        = errors.New("Lockfile contains invalid pid for system")
+	ErrDeadOwner         = errors.New("Lockfile contains pid of process not existent on this system anymore")
+	ErrRogueDeletion     = errors.New("Lockfile owned by me has been removed unexpectedly")
+	ErrNotRegularFile    = errors.New("Lockfile exists, but is no regular file")
+	ErrInvalidName       = errors.New("Lockfile name is empty or refers to a directory")
+	ErrEmptyPath         = errors.New("Lockfile path is empty")
+	ErrIsDirectory       = errors.New("Lockfile path is a directory")
+	ErrOversizeLockfile  = errors.New("Lockfile is too large to be a lockfile")
+	ErrReadOnlyFS        = errors.New("Lockfile is not locked, but cannot be written")
+	ErrDuplicateInstance = errors.New("Lockfile is already held by another Lockfile of this process")
+	ErrCrossDevice       = errors.New("Lockfile cannot be moved to another filesystem")
+	ErrNoDefaultDir      = errors.New("Lockfile directory has not been set via SetDefaultDir")
+	ErrTransferred       = errors.New("Lockfile has been transferred to another process")
+	ErrNoTTL             = errors.New("Lockfile has been acquired without TTL")
+	ErrXattrUnsupported  = errors.New("Lockfile cannot have extended attributes here")
+	ErrDirChanged        = errors.New("Lockfile directory has changed since the lock has been acquired")
+	ErrPathTooLong       = errors.New("Lockfile path is too long")
+	ErrFlockUnsupported  = errors.New("Lockfile cannot be locked via flock here")
+	ErrSuspiciousLinks   = errors.New("Lockfile has more than one hard link")
+	ErrDirNotWritable    = errors.New("Lockfile directory is not writable")
+	ErrIOTimeout         = TemporaryError("Lockfile operation timed out")
 )
 
+// Errors returns all errors above, e.g. to check that each of them is handled.
+func Errors() []error {
+	return []error{
+		ErrBusy,
+		ErrNotExist,
+		ErrNeedAbsPath,
+		ErrInvalidPid,
+		ErrDeadOwner,
+		ErrRogueDeletion,
+		ErrNotRegularFile,
+		ErrInvalidName,
+		ErrEmptyPath,
+		ErrIsDirectory,
+		ErrOversizeLockfile,
+		ErrReadOnlyFS,
+		ErrDuplicateInstance,
+		ErrCrossDevice,
+		ErrNoDefaultDir,
+		ErrTransferred,
+		ErrNoTTL,
+		ErrXattrUnsupported,
+		ErrDirChanged,
+		ErrPathTooLong,
+		ErrFlockUnsupported,
+		ErrSuspiciousLinks,
+		ErrDirNotWritable,
+		ErrIOTimeout,
+	}
+}
+
 // New describes a new filename located at the given absolute path.
-func New(path string) (Lockfile, error) {
+func New(path string, opts ...Option) (Lockfile, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	err := checkPath(path)
+	if err == ErrIsDirectory && o.lockInsideDir {
+		path = filepath.Join(path, DirLockName)
+		err = checkPath(path)
+	}
+	if err != nil {
+		return Lockfile{}, err
+	}
+
+	if o.resolveSymlinks {
+		if path, err = resolveDir(path); err != nil {
+			return Lockfile{}, err
+		}
+	}
+
+	path, err = fitPath(path, o.truncateName)
+	if err != nil {
+		return Lockfile{}, err
+	}
+
+	pid, err := o.resolvePID()
+	if err != nil {
+		return Lockfile{}, err
+	}
+	o.pid = pid
+
+	if o.emptyContent && !haveFlock {
+		return Lockfile{}, ErrFlockUnsupported
+	}
+
+	if o.tempDir != "" {
+		if err := checkSameDevice(o.tempDir, filepath.Dir(path)); err != nil {
+			return Lockfile{}, err
+		}
+	}
+
+	if o.checkWritable {
+		if err := checkWritable(o.fs, filepath.Dir(path)); err != nil {
+			return Lockfile{}, err
+		}
+		if o.tempDir != "" {
+			if err := checkWritable(o.fs, o.tempDir); err != nil {
+				return Lockfile{}, err
+			}
+		}
+	}
+
+	l := Lockfile{name: path, opts: o, st: &state{}}
+	if err := l.checkDuplicate(); err != nil {
+		return Lockfile{}, err
+	}
+
+	return l, nil
+}
+
+// resolveDir returns path with symlinks in its directory resolved, see WithResolveSymlinks.
+// The lockfile itself is left alone, as it might not exist yet, and so is a path in a missing directory.
+func resolveDir(path string) (string, error) {
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// checkPath returns why path cannot name a lockfile, if it cannot.
+func checkPath(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return ErrEmptyPath
+	}
+
 	if !filepath.IsAbs(path) {
-		return Lockfile(""), ErrNeedAbsPath
+		return ErrNeedAbsPath
+	}
+
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return ErrIsDirectory
+	}
+
+	return nil
+}
+
+// String returns the path name of the lockfile.
+func (l Lockfile) String() string {
+	return l.name
+}
+
+// Key returns the canonical path name of the lockfile, which suits map keys and sets.
+// It is cleaned and symlinks in its directory are resolved, as far as it exists.
+func (l Lockfile) Key() string {
+	name := filepath.Clean(l.name)
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(name)); err == nil {
+		return filepath.Join(dir, filepath.Base(name))
 	}
 
-	return Lockfile(path), nil
+	return name
+}
+
+// Equal reports whether l and other describe the same lockfile, i.e. have the same Key.
+func (l Lockfile) Equal(other Lockfile) bool {
+	return l.Key() == other.Key()
 }
 
 // GetOwner returns who owns the lockfile.
 func (l Lockfile) GetOwner() (*os.Process, error) {
-	name := string(l)
-
-	// Ok, see, if we have a stale lockfile here
-	content, err := ioutil.ReadFile(name)
+	info, err := l.owner()
 	if err != nil {
-		return nil, err
+		return nil, l.wrapErr(err)
 	}
 
-	// try hard for pids. If no pid, the lockfile is junk anyway and we delete it.
-	pid, err := scanPidLine(content)
+	return os.FindProcess(info.PID)
+}
+
+// owner returns what the lockfile records about its owner, if that is still running.
+// Otherwise it returns ErrDeadOwner together with what has been recorded.
+// Owners on other hosts are assumed to be running, as we cannot tell.
+func (l Lockfile) owner() (LockInfo, error) {
+	info, err := l.readInfo()
 	if err != nil {
-		return nil, err
+		return LockInfo{}, err
+	}
+
+	if l.isForeign(info) {
+		return info, nil
 	}
 
-	running, err := isRunning(pid)
+	running, err := l.isRunning(info.PID)
 	if err != nil {
-		return nil, err
+		return LockInfo{}, err
 	}
 
-	if running {
-		proc, err := os.FindProcess(pid)
-		if err != nil {
-			return nil, err
+	if !running {
+		return info, ErrDeadOwner
+	}
+
+	return info, nil
+}
+
+// settledOwner works like owner, but reads an invalid lockfile again a few times,
+// as another process might just be writing it. See WithInvalidPidRetries.
+func (l Lockfile) settledOwner() (LockInfo, error) {
+	o := l.options()
+	for i := 0; ; i++ {
+		info, err := l.owner()
+		if err != ErrInvalidPid || i >= o.invalidPidRetries {
+			return info, err
 		}
 
-		return proc, nil
+		<-o.clock.After(o.invalidPidRetryDelay)
 	}
+}
 
-	return nil, ErrDeadOwner
+// LockedByMe reports whether the lockfile exists and names this process as its owner.
+// Check this before calling Unlock to avoid ErrRogueDeletion.
+func (l Lockfile) LockedByMe() (bool, error) {
+	if l.st != nil && l.options().emptyContent {
+		return l.flockHeld(), nil
+	}
+
+	info, err := l.readInfo()
+	switch {
+	case err == nil:
+		return l.isMine(info) && !l.lingers(), nil
+	case err == ErrInvalidPid, os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, err
+	}
 }
 
 // TryLock tries to own the lock.
 // It Returns nil, if successful and and error describing the reason, it didn't work out.
 // Please note, that existing lockfiles containing pids of dead processes
 // and lockfiles containing no pid at all are simply deleted.
+//
+// A live owner only keeps us from acquiring the lock, if its process name matches expProcName,
+// as its pid might have been reused by an unrelated process. An empty expProcName skips this check,
+// so every live owner keeps us from acquiring the lock.
 func (l Lockfile) TryLock(expProcName string) error {
-	name := string(l)
+	return l.acquire(expProcName, func() (LockInfo, error) {
+		return l.newInfo(), nil
+	})
+}
+
+// TryLockDefault works like TryLock, expecting owners to have the name of this executable, see DefaultProcName.
+func (l Lockfile) TryLockDefault() error {
+	return l.TryLock(DefaultProcName())
+}
+
+// DefaultProcName returns the base name of the executable of this process, as given by os.Args[0].
+// Processes running the same executable share it, so it suits as the name passed to TryLock,
+// if they are the only ones using the lockfile.
+func DefaultProcName() string {
+	if len(os.Args) == 0 {
+		return ""
+	}
+
+	return filepath.Base(os.Args[0])
+}
+
+// acquire tries to own the lock, keeping track of it within this process.
+func (l Lockfile) acquire(expProcName string, info func() (LockInfo, error)) error {
+	_, err := l.acquireKind(expProcName, info)
+	return err
+}
+
+// acquireKind implements acquire, also telling how the lockfile came to be ours.
+func (l Lockfile) acquireKind(expProcName string, info func() (LockInfo, error)) (kind CreationKind, err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if isGloballyDisabled() {
+		return 0, nil
+	}
+
+	defer func() {
+		if err == nil {
+			l.startLease()
+		}
+	}()
+
+	if l.st != nil && l.options().emptyContent {
+		return l.acquireFlock(flockTry)
+	}
+
+	if l.st == nil {
+		return l.tryLock(expProcName, info, false, Created)
+	}
+
+	kind, err = l.acquireTracked(expProcName, info)
+	if err == ErrBusy && l.options().softMode {
+		return 0, l.softConflict()
+	}
+	setConflicts(l.st, nil)
+
+	return kind, err
+}
+
+// acquireTracked implements acquireKind for a Lockfile made by New.
+func (l Lockfile) acquireTracked(expProcName string, info func() (LockInfo, error)) (CreationKind, error) {
+	return l.track(func() (CreationKind, error) {
+		if l.options().unlockDelay > 0 {
+			li, err := info()
+			if err != nil {
+				return 0, err
+			}
+			if l.readopt(li) {
+				return ReplacedOwn, nil
+			}
+			info = reuseInfo(li, info)
+		}
+
+		return l.tryLock(expProcName, info, false, Created)
+	})
+}
+
+// track registers the lock within this process around take, which makes the lockfile ours,
+// like all ways of acquiring the lock by a Lockfile made by New do. Watching the lease is up to the caller.
+func (l Lockfile) track(take func() (CreationKind, error)) (CreationKind, error) {
+	if err := l.checkDuplicate(); err != nil {
+		return 0, err
+	}
+
+	fresh := false
+	if l.options().registry {
+		var ok bool
+		if ok, fresh = reserve(l.name, l.st); !ok {
+			return 0, ErrBusy
+		}
+	}
+
+	kind, err := take()
+	if err != nil {
+		if fresh {
+			release(l.name, l.st)
+		}
+		return 0, err
+	}
+
+	hold(l.name, l.st)
+	touch(l.st, l.options().clock.Now())
+	l.recordDir()
+	l.record("acquired")
+	return kind, nil
+}
+
+// tryLock implements TryLock, getting the lockfile content to write from info on each attempt.
+// It waits for a lockfile to become stale only, if it didn't do so already.
+// kind tells how the lockfile comes to be ours, if this attempt succeeds.
+func (l Lockfile) tryLock(expProcName string, info func() (LockInfo, error), waited bool, kind CreationKind) (CreationKind, error) {
+	name := l.name
 
 	// This has been checked by New already. If we trigger here,
 	// the caller didn't use New and re-implemented it's functionality badly.
@@ -99,9 +422,26 @@ func (l Lockfile) TryLock(expProcName string) error {
 		panic(ErrNeedAbsPath)
 	}
 
-	tmplock, cleanup, err := makePidFile(name, os.Getpid())
+	// Don't even try to handle a pipe or device someone put in our way.
+	if err := checkRegular(name); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	li, err := info()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	data, err := l.options().encoder.Encode(li)
+	if err != nil {
+		return 0, err
+	}
+
+	fs := l.fs()
+
+	tmplock, cleanup, err := l.makePidFile(data)
+	if err != nil {
+		return 0, l.writeFailed(err, expProcName)
 	}
 
 	defer cleanup()
@@ -113,78 +453,276 @@ func (l Lockfile) TryLock(expProcName string) error {
 	// We cannot ignore ALL errors, since failure to support hard links, disk full
 	// as well as many other errors can happen to a filesystem operation
 	// and we really want to abort on those.
-	if err := os.Link(tmplock, name); err != nil {
+	if err := fs.Link(tmplock, name); err != nil {
 		if !os.IsExist(err) {
-			return err
+			return 0, l.writeFailed(err, expProcName)
 		}
 	}
 
 	fiTmp, err := os.Lstat(tmplock)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	fiLock, err := os.Lstat(name)
 	if err != nil {
 		// tell user that a retry would be a good idea
 		if os.IsNotExist(err) {
-			return ErrNotExist
+			return 0, ErrNotExist
 		}
 
-		return err
+		return 0, err
 	}
 
 	// Success
 	if os.SameFile(fiTmp, fiLock) {
-		return nil
+		return kind, nil
 	}
 
-	proc, err := l.GetOwner()
+	owner, err := l.settledOwner()
 
 	switch err {
 	default:
 		// Other errors -> defensively fail and let caller handle this
-		return err
+		return 0, err
 	case nil:
-		newProc, err := process.NewProcess(int32(proc.Pid))
-		if err != nil {
-			return err
+		if l.options().noAutoReap && !l.isMine(owner) {
+			return 0, ErrBusy
 		}
-		newProcName, err := newProc.Name()
+
+		busy, err := l.blocks(owner, expProcName)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		if proc.Pid != os.Getpid() && strings.Contains(strings.ToLower(newProcName), strings.ToLower(expProcName)) {
-			return ErrBusy
+		if busy {
+			remaining, expires := l.staleIn(fiLock, owner)
+			switch {
+			case l.outlived(fiLock, owner) != "":
+				// outlived its TTL or WithStaleAfter, so we reap it below
+			case expires && l.options().waitForStale && !waited:
+				<-l.options().clock.After(remaining)
+				return l.tryLock(expProcName, info, true, Created)
+			case l.options().recheckBusy && l.ownerExited(owner.PID):
+				// exited right after our check, so we reap it below
+			default:
+				return 0, ErrBusy
+			}
+		}
+
+		kind = ReapedStale
+		if l.isMine(owner) {
+			kind = ReplacedOwn
+		}
+	case ErrDeadOwner:
+		if l.options().noAutoReap {
+			return 0, ErrBusy
 		}
-	case ErrDeadOwner, ErrInvalidPid: // cases we can fix below
+		kind = ReapedStale
+	case ErrInvalidPid: // cases we can fix below
+		kind = ReplacedEmpty
 	}
 
-	// clean stale/invalid lockfile
-	err = os.Remove(name)
+	if err := l.checkLinks(); err != nil {
+		return 0, err
+	}
+
+	if kind == ReapedStale {
+		if err := l.preReap(owner); err != nil {
+			return 0, err
+		}
+	}
+
+	// clean stale/invalid lockfile and its renewal count
+	l.archiveReaped()
+	_ = fs.Remove(renewalsName(name))
+	err = fs.Remove(name)
 	if err != nil {
 		// If it doesn't exist, then it doesn't matter who removed it.
 		if !os.IsNotExist(err) {
-			return err
+			return 0, l.writeFailed(err, expProcName)
 		}
 	}
 
 	// now that the stale lockfile is gone, let's recurse
-	return l.TryLock(expProcName)
+	return l.tryLock(expProcName, info, waited, kind)
+}
+
+// writeFailed returns the error to report, when writing the lockfile failed with err.
+// With WithReadOnly, failures due to a read-only filesystem are reported as ErrBusy,
+// if a live owner keeps us from acquiring the lock, and as ErrReadOnlyFS otherwise.
+func (l Lockfile) writeFailed(err error, expProcName string) error {
+	if !l.options().readOnly || !isReadOnly(err) {
+		return err
+	}
+
+	owner, err := l.owner()
+	if err == nil {
+		busy, err := l.blocks(owner, expProcName)
+		if err != nil {
+			return err
+		}
+		if busy {
+			return ErrBusy
+		}
+	}
+
+	return ErrReadOnlyFS
+}
+
+// blocks reports whether the live owner keeps us from acquiring the lock.
+// That is an owner on another host or a process of another name than expProcName, but not us.
+func (l Lockfile) blocks(owner LockInfo, expProcName string) (bool, error) {
+	if l.isForeign(owner) {
+		return true, nil
+	}
+
+	if l.isMine(owner) {
+		return false, nil
+	}
+
+	// Every name matches none given, so there is no need to look it up.
+	if expProcName == "" {
+		return true, nil
+	}
+
+	newProcName, err := l.processName(owner.PID)
+	if err != nil {
+		return false, err
+	}
+
+	return l.options().matchName(expProcName, newProcName), nil
+}
+
+// commLen is the length Linux truncates process names to.
+const commLen = 15
+
+// matchName is the default of WithNameMatcher.
+func matchName(recorded, live string) bool {
+	recorded, live = strings.ToLower(recorded), strings.ToLower(live)
+	if strings.Contains(live, recorded) {
+		return true
+	}
+
+	// a truncated name is a prefix of the full one
+	return len(live) >= commLen && strings.HasPrefix(recorded, live)
+}
+
+// isMine reports whether info names this process as the owner.
+func (l Lockfile) isMine(info LockInfo) bool {
+	return info.PID == l.options().pid && !l.isForeign(info)
+}
+
+// isForeign reports whether info names an owner on another host.
+// Without knowing our own hostname, no owner is foreign.
+func (l Lockfile) isForeign(info LockInfo) bool {
+	hostname := l.options().hostname
+	return hostname != "" && info.Hostname != "" && info.Hostname != hostname
+}
+
+// ownerExited reports whether the lockfile is still owned by pid, which isn't running anymore.
+func (l Lockfile) ownerExited(pid int) bool {
+	info, err := l.readInfo()
+	if err != nil || info.PID != pid || l.isForeign(info) {
+		return false
+	}
+
+	running, err := l.isRunning(pid)
+	return err == nil && !running
+}
+
+// isRunning tells whether the process pid is running using the configured liveness checker.
+// With WithZombieAsDead, zombies are not.
+// With WithLivenessCacheTTL, a recent finding of a running process is reused.
+func (l Lockfile) isRunning(pid int) (bool, error) {
+	cache := l.options().livenessCache
+	if cache != nil && cache.cachedRunning(pid, l.options().clock.Now()) {
+		return true, nil
+	}
+
+	running, err := l.checkRunning(pid)
+	if err == nil && running && l.options().zombieAsDead {
+		running = !l.isZombie(pid)
+	}
+
+	if err == nil && cache != nil {
+		cache.store(pid, running, l.options().clock.Now())
+	}
+
+	return running, err
 }
 
 // Unlock a lock again, if we owned it. Returns any error that happened during release of lock.
+// Only the very file we created is removed: A lockfile naming us, which has been recreated
+// or rewritten by someone else meanwhile, is left alone and reported as ErrRogueDeletion.
 func (l Lockfile) Unlock() error {
-	proc, err := l.GetOwner()
+	return l.unlock(nil)
+}
+
+// unlock implements Unlock. If leased is set, only the lock found by the lease watcher is released.
+func (l Lockfile) unlock(leased *leasedLock) (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if isGloballyDisabled() {
+		return nil
+	}
+
+	if err := l.checkDir(); err != nil {
+		return err
+	}
+
+	if l.st != nil && l.options().emptyContent {
+		return l.unlockFlock(leased)
+	}
+
+	owner, err := l.owner()
 	switch err {
 	case ErrInvalidPid, ErrDeadOwner:
 		return ErrRogueDeletion
 	case nil:
-		if proc.Pid == os.Getpid() {
+		if l.isMine(owner) {
+			// Someone removed our lockfile and another one with our pid took its place.
+			if l.st != nil && replaced(l.name, l.st) {
+				return ErrRogueDeletion
+			}
+
+			// We released it meanwhile and acquired it anew, so the lease has been renewed.
+			if leased != nil && replacedSince(l.name, leased.file) {
+				return ErrRogueDeletion
+			}
+
+			if err := l.checkLinks(); err != nil {
+				return err
+			}
+
+			if l.st != nil && l.options().unlockDelay > 0 {
+				l.linger()
+				l.record("released")
+				return nil
+			}
+
+			// Only while we still hold it, the renewal count is ours to remove, see RenewalCount.
+			_ = l.fs().Remove(renewalsName(l.name))
+
 			// we really own it, so let's remove it.
-			return os.Remove(string(l))
+			if err := l.fs().Remove(l.name); err != nil {
+				return err
+			}
+
+			if l.st != nil {
+				release(l.name, l.st)
+			}
+			l.record("released")
+			return nil
 		}
 		// Not owned by me, so don't delete it.
+		if l.st != nil && conflicts(l.st) != nil {
+			// We never owned it in the first place, see WithSoftMode.
+			setConflicts(l.st, nil)
+			return nil
+		}
+		if l.st != nil && transferredTo(l.st) == owner.PID {
+			return ErrTransferred
+		}
 		return ErrRogueDeletion
 	default:
 		// This is an application error or system error.
@@ -197,6 +735,46 @@ func (l Lockfile) Unlock() error {
 	}
 }
 
+// Close gives up the lock within this process, whether or not Unlock succeeded.
+// It frees the slot of l in the in-process registry and closes a descriptor adopted via AdoptFromEnv,
+// but leaves the lockfile alone. After Unlock failed with ErrRogueDeletion, this allows
+// other Lockfiles of this process to acquire the lock again.
+// Calling Close after Unlock or more than once is harmless.
+func (l Lockfile) Close() error {
+	if l.st != nil {
+		release(l.name, l.st)
+	}
+
+	return nil
+}
+
+// ForceUnlock removes the lockfile regardless of its owner.
+// This clears locks, which TryLock doesn't reap due to WithNoAutoReap.
+// Make sure the owner is really gone, as it will keep working as if it held the lock.
+// A missing lockfile is no error.
+func (l Lockfile) ForceUnlock() (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if err := checkRegular(l.name); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := l.fs().Remove(l.name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if l.st != nil {
+		release(l.name, l.st)
+	}
+
+	return nil
+}
+
+// scanPidLine returns the pid on the first line of content.
+// The line may lack its newline, as with WithPidfileCompat or a lockfile truncated after the pid.
 func scanPidLine(content []byte) (int, error) {
 	if len(content) == 0 {
 		return 0, ErrInvalidPid
@@ -214,21 +792,141 @@ func scanPidLine(content []byte) (int, error) {
 	return pid, nil
 }
 
-func makePidFile(name string, pid int) (tmpname string, cleanup func(), err error) {
-	tmplock, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".")
+// scanPidLineVerbose works like scanPidLine, but also returns the first line of content as it is,
+// so tools can show what a corrupt lockfile contains instead of the pid.
+func scanPidLineVerbose(content []byte) (pid int, raw string, err error) {
+	raw = string(content)
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		raw = string(content[:i])
+	}
+
+	pid, err = scanPidLine(content)
+	return pid, raw, err
+}
+
+// checkRegular returns ErrIsDirectory or ErrNotRegularFile, if name exists but is no regular file.
+// Reading a named pipe or a device could block forever or worse.
+func checkRegular(name string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	return notRegular(fi)
+}
+
+// notRegular returns ErrIsDirectory for a directory and ErrNotRegularFile for anything else, which is no regular file.
+// A directory is usually created by accident, so it gets its own error.
+func notRegular(fi os.FileInfo) error {
+	switch {
+	case fi.IsDir():
+		return ErrIsDirectory
+	case !fi.Mode().IsRegular():
+		return ErrNotRegularFile
+	}
+
+	return nil
+}
+
+// readLockfile returns the content of the lockfile, if it is a regular file of sane size.
+func (l Lockfile) readLockfile() ([]byte, error) {
+	fi, err := os.Stat(l.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := notRegular(fi); err != nil {
+		return nil, err
+	}
+
+	max := l.options().maxFileSize
+	if fi.Size() > max {
+		return nil, ErrOversizeLockfile
+	}
+
+	f, err := l.fs().Open(l.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// It might still grow after we checked its size.
+	content, err := ioutil.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) > max {
+		return nil, ErrOversizeLockfile
+	}
+
+	return content, nil
+}
+
+// Size returns the size of the lockfile in bytes.
+func (l Lockfile) Size() (int64, error) {
+	fi, err := os.Stat(l.name)
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+// makePidFile writes content to a temporary file next to the lockfile or in the directory given by WithTempDir.
+// It has the mode given by WithFileMode.
+func (l Lockfile) makePidFile(content []byte) (tmpname string, cleanup func(), err error) {
+	tmpname, cleanup, err = l.makeTempFile(l.name, content)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Set before the lockfile appears, so it never lacks them.
+	if l.options().xattrMetadata {
+		l.setXattrMetadata(tmpname)
+	}
+
+	return tmpname, cleanup, nil
+}
+
+// makeTempFile writes content to a temporary file, which is to become the file name,
+// next to it or in the directory given by WithTempDir. It has the mode given by WithFileMode.
+func (l Lockfile) makeTempFile(name string, content []byte) (tmpname string, cleanup func(), err error) {
+	dir := l.options().tempDir
+	if dir == "" {
+		dir = filepath.Dir(name)
+	}
+
+	return l.makeTempFileIn(dir, name, content)
+}
+
+// makeTempFileIn writes content to a temporary file in dir, which is to become the file name.
+// It has the mode given by WithFileMode.
+func (l Lockfile) makeTempFileIn(dir, name string, content []byte) (tmpname string, cleanup func(), err error) {
+	fs := l.fs()
+	prefix := truncateName(filepath.Base(name), maxNameLen-len(".")-tempRandomLen) + "."
+	tmplock, err := fs.TempFile(dir, prefix)
 	if err != nil {
 		return "", nil, err
 	}
 
 	cleanup = func() {
 		_ = tmplock.Close()
-		_ = os.Remove(tmplock.Name())
+		_ = fs.Remove(tmplock.Name())
 	}
 
-	if _, err := io.WriteString(tmplock, fmt.Sprintf("%d\n", pid)); err != nil {
+	if _, err := tmplock.Write(content); err != nil {
 		cleanup() // Do cleanup here, so call doesn't have to.
 		return "", nil, err
 	}
 
+	// The umask doesn't apply here, so the mode is exactly the one requested.
+	if mode := l.options().fileMode; mode != 0 {
+		if err := tmplock.Chmod(mode); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+
 	return tmplock.Name(), cleanup, nil
 }
@@ -1,15 +1,21 @@
 package lockfile
 
 import (
+	"errors"
 	"fmt"
 	"github.com/shirou/gopsutil/v4/process"
 	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func ExampleLockfile() {
@@ -64,6 +70,112 @@ func TestBasicLockUnlock(t *testing.T) {
 	}
 }
 
+func TestNewInvalidPath(t *testing.T) {
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [...]struct {
+		path  string
+		xfail error
+	}{
+		{path: "", xfail: ErrEmptyPath},
+		{path: "   ", xfail: ErrEmptyPath},
+		{path: "test_lockfile.pid", xfail: ErrNeedAbsPath},
+		{path: dir, xfail: ErrIsDirectory},
+	}
+
+	for step, tc := range tests {
+		if _, got := New(tc.path); got != tc.xfail {
+			t.Errorf("%d: expected error %v, got %v", step, tc.xfail, got)
+		}
+	}
+}
+
+func TestTryLockOnDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone created a directory in our way after New.
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lf.TryLock("main"); got != ErrIsDirectory {
+		t.Fatalf("expected error %q, got %v", ErrIsDirectory, got)
+	}
+
+	if _, got := lf.GetOwner(); got != ErrIsDirectory {
+		t.Fatalf("expected error %q, got %v", ErrIsDirectory, got)
+	}
+}
+
+func TestWithLockInsideDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithLockInsideDirectory())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := filepath.Join(path, DirLockName); lf.String() != want {
+		t.Fatalf("got lockfile %q, want %q", lf, want)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(filepath.Join(dir, "test.lck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [...]struct {
+		path  string
+		equal bool
+	}{
+		{path: filepath.Join(dir, "test.lck"), equal: true},
+		{path: dir + string(filepath.Separator) + filepath.Join("sub", "..", "test.lck"), equal: true},
+		{path: dir + string(filepath.Separator) + "." + string(filepath.Separator) + "test.lck", equal: true},
+		{path: filepath.Join(dir, "sub", "test.lck")},
+		{path: filepath.Join(dir, "other.lck")},
+	}
+
+	for step, tc := range tests {
+		other, err := New(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := lf.Equal(other); got != tc.equal {
+			t.Errorf("%d: %s: expected equal %v, got %v", step, tc.path, tc.equal, got)
+		}
+		if got := lf.Key() == other.Key(); got != tc.equal {
+			t.Errorf("%d: %s: expected equal keys %v, got %q and %q", step, tc.path, tc.equal, lf.Key(), other.Key())
+		}
+	}
+}
+
 func GetDeadPID() int {
 	// I have no idea how windows handles large PIDs, or if they even exist.
 	// So limit it to be less or equal to 4096 to be safe.
@@ -92,6 +204,27 @@ func GetDeadPID() int {
 	panic(fmt.Sprintf("all pids lower %d are used, cannot test this", maxPid))
 }
 
+// writeBusyLockfile makes path look owned by our parent process
+// and returns the name to pass to TryLock, so it reports ErrBusy.
+func writeBusyLockfile(t *testing.T, path string) string {
+	pid := os.Getppid()
+
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := proc.Name()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
 func TestBusy(t *testing.T) {
 	path, err := filepath.Abs("test_lockfile.pid")
 	if err != nil {
@@ -120,6 +253,183 @@ func TestBusy(t *testing.T) {
 	}
 }
 
+// ownerExitingAfter is a liveness checker reporting owner as running for its first n checks.
+func ownerExitingAfter(owner, n int) func(pid int) (bool, error) {
+	checks := 0
+	return func(pid int) (bool, error) {
+		if pid != owner {
+			return isRunning(pid)
+		}
+		checks++
+		return checks <= n, nil
+	}
+}
+
+func TestBusyRecheck(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	lf, err := New(path, WithLivenessChecker(ownerExitingAfter(os.Getppid(), 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lf.TryLock(name); got != ErrBusy {
+		t.Fatalf("without recheck: expected error %q, got %v", ErrBusy, got)
+	}
+
+	lf, err = New(path, WithLivenessChecker(ownerExitingAfter(os.Getppid(), 1)), WithBusyRecheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("with recheck: unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForeignHost(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithHostname("here"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither a dead pid nor our own one matter on another host.
+	for _, pid := range []int{GetDeadPID(), os.Getpid()} {
+		content := fmt.Sprintf("%d\nhost=there\n", pid)
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := lf.TryLock("main"); got != ErrBusy {
+			t.Fatalf("pid %d: expected error %q, got %v", pid, ErrBusy, got)
+		}
+
+		if got := lf.Unlock(); got != ErrRogueDeletion {
+			t.Fatalf("pid %d: expected error %q, got %v", pid, ErrRogueDeletion, got)
+		}
+	}
+
+	// but a dead pid on our own host does
+	content := fmt.Sprintf("%d\nhost=here\n", GetDeadPID())
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d\nhost=here\n", os.Getpid()); string(got) != want {
+		t.Fatalf("got content %q, want %q", got, want)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPIDResolver(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as if our parent were our pid on the host
+	pid := os.Getppid()
+	lf, err := New(path, WithPIDResolver(func() (int, error) { return pid, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d\n", pid); string(got) != want {
+		t.Fatalf("got content %q, want %q", got, want)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := errors.New("no pid")
+	if _, got := New(path, WithPIDResolver(func() (int, error) { return 0, want })); got != want {
+		t.Fatalf("expected error %q, got %v", want, got)
+	}
+}
+
+func TestOversizeLockfile(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as if a log got redirected into it
+	content := fmt.Sprintf("%d\n%s", os.Getppid(), strings.Repeat("log line\n", 1000))
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lf.TryLock("main"); got != ErrOversizeLockfile {
+		t.Fatalf("expected error %q, got %v", ErrOversizeLockfile, got)
+	}
+
+	size, err := lf.Size()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := int64(len(content)); size != want {
+		t.Fatalf("got size %d, want %d", size, want)
+	}
+
+	lf, err = New(path, WithMaxFileSize(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := lf.GetOwner()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if proc.Pid != os.Getppid() {
+		t.Fatalf("got owner %d, want %d", proc.Pid, os.Getppid())
+	}
+}
+
 func TestRogueDeletion(t *testing.T) {
 	path, err := filepath.Abs("test_lockfile.pid")
 	if err != nil {
@@ -189,6 +499,65 @@ func TestRogueDeletionDeadPid(t *testing.T) {
 	}
 }
 
+func TestRogueDeletionSamePid(t *testing.T) {
+	tests := [...]struct {
+		name    string
+		replace func(path string, content []byte) error
+	}{
+		{
+			name: "another file",
+			replace: func(path string, content []byte) error {
+				// Keep the old file around, so the new one cannot reuse its inode.
+				if err := os.Rename(path, path+".old"); err != nil {
+					return err
+				}
+				return ioutil.WriteFile(path, content, 0666)
+			},
+		},
+		{
+			name: "rewritten in place",
+			replace: func(path string, content []byte) error {
+				if err := ioutil.WriteFile(path, content, 0666); err != nil {
+					return err
+				}
+				// as if written a moment later, which coarse timestamps might not tell
+				later := time.Now().Add(time.Second)
+				return os.Chtimes(path, later, later)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		path := filepath.Join(t.TempDir(), "test.lck")
+
+		lf, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tc.replace(path, content); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.Unlock(); err != ErrRogueDeletion {
+			t.Errorf("%s: expected error %v, got %v", tc.name, ErrRogueDeletion, err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s: lockfile we didn't create has been removed: %v", tc.name, err)
+		}
+	}
+}
+
 func TestRemovesStaleLockOnDeadOwner(t *testing.T) {
 	path, err := filepath.Abs("test_lockfile.pid")
 	if err != nil {
@@ -237,11 +606,16 @@ func TestInvalidPidLeadToReplacedLockfileAndSuccess(t *testing.T) {
 		return
 	}
 
-	if err := lf.TryLock("main"); err != nil {
+	res, err := lf.TryLockEx("main")
+	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 		return
 	}
 
+	if res.Kind != ReplacedEmpty {
+		t.Fatalf("got kind %v, want %v", res.Kind, ReplacedEmpty)
+	}
+
 	// now check if file exists and contains the correct content
 	got, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -254,6 +628,80 @@ func TestInvalidPidLeadToReplacedLockfileAndSuccess(t *testing.T) {
 	}
 }
 
+func TestDefaultProcName(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip("cannot tell executable:", err)
+	}
+
+	if got, want := DefaultProcName(), filepath.Base(exe); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	lf, err := New(filepath.Join(t.TempDir(), "test.lck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLockDefault(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTryLockWithoutName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	writeBusyLockfile(t, path)
+
+	// The owner keeps the lock regardless of its name, so even a matcher refusing all names doesn't matter.
+	lf, err := New(path, WithNameMatcher(func(recorded, live string) bool { return false }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(""); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+}
+
+func TestLockedByMe(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || mine {
+		t.Fatalf("missing lockfile: got %v, %v, want false, <nil>", mine, err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	if mine, err := lf.LockedByMe(); err != nil || !mine {
+		t.Fatalf("own lockfile: got %v, %v, want true, <nil>", mine, err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	if mine, err := lf.LockedByMe(); err != nil || mine {
+		t.Fatalf("foreign lockfile: got %v, %v, want false, <nil>", mine, err)
+	}
+}
+
 func TestScanPidLine(t *testing.T) {
 	tests := [...]struct {
 		input []byte
@@ -267,6 +715,10 @@ func TestScanPidLine(t *testing.T) {
 		{input: []byte("0\n"), xfail: ErrInvalidPid},
 		{input: []byte("a\n"), xfail: ErrInvalidPid},
 		{input: []byte("1\n"), pid: 1},
+		{input: []byte("1234"), pid: 1234},
+		{input: []byte("1234 "), pid: 1234},
+		{input: []byte("1234\r\n"), pid: 1234},
+		{input: []byte("12 34"), xfail: ErrInvalidPid},
 	}
 
 	// test positive cases first
@@ -298,6 +750,27 @@ func TestScanPidLine(t *testing.T) {
 	}
 }
 
+func TestScanPidLineVerbose(t *testing.T) {
+	tests := [...]struct {
+		input []byte
+		pid   int
+		raw   string
+		xfail error
+	}{
+		{input: []byte("1234\ntoken=7\n"), pid: 1234, raw: "1234"},
+		{input: []byte("junk\x00\xff\npid=1\n"), raw: "junk\x00\xff", xfail: ErrInvalidPid},
+		{input: []byte("12 34"), raw: "12 34", xfail: ErrInvalidPid},
+		{input: []byte(""), xfail: ErrInvalidPid},
+	}
+
+	for step, tc := range tests {
+		pid, raw, err := scanPidLineVerbose(tc.input)
+		if pid != tc.pid || raw != tc.raw || err != tc.xfail {
+			t.Errorf("%d: got %d, %q, %v, want %d, %q, %v", step, pid, raw, err, tc.pid, tc.raw, tc.xfail)
+		}
+	}
+}
+
 // custom
 
 func TestTryLock_Success(t *testing.T) {
@@ -381,3 +854,164 @@ func TestTryLock_DifferentProcessName(t *testing.T) {
 	err = lock.TryLock("anotherprocess")
 	assert.NoError(t, err) // Since the process name doesn't match, we should be able to acquire the lock.
 }
+
+func TestErrors(t *testing.T) {
+	// Collect the names of all errors declared by this package.
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	declared := map[string]bool{}
+	for _, f := range pkgs["lockfile"].Files {
+		for _, obj := range f.Scope.Objects {
+			if obj.Kind == ast.Var && strings.HasPrefix(obj.Name, "Err") {
+				declared[obj.Name] = true
+			}
+		}
+	}
+
+	errs := Errors()
+	if len(errs) != len(declared) {
+		t.Errorf("got %d errors, but %d are declared: %v", len(errs), len(declared), declared)
+	}
+
+	seen := map[error]bool{}
+	for _, err := range errs {
+		if seen[err] {
+			t.Errorf("error %q listed twice", err)
+		}
+		seen[err] = true
+	}
+
+	for _, want := range []error{ErrBusy, ErrRogueDeletion, ErrInvalidPid, ErrCrossDevice} {
+		if !seen[want] {
+			t.Errorf("error %q missing", want)
+		}
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	tests := [...]struct {
+		recorded string
+		live     string
+		want     bool
+	}{
+		{recorded: "main", live: "main", want: true},
+		{recorded: "main", live: "MAIN", want: true},
+		{recorded: "main", live: "main.test", want: true},
+		{recorded: "main", live: "other"},
+		{recorded: "my-long-daemon-name", live: "my-long-daemon-", want: true},
+		{recorded: "my-long-daemon-name", live: "my-long-daemon-x"},
+		{recorded: "my-long-daemon-name", live: "my-long"},
+	}
+
+	for step, tc := range tests {
+		if got := matchName(tc.recorded, tc.live); got != tc.want {
+			t.Errorf("%d: matchName(%q, %q) = %v, want %v", step, tc.recorded, tc.live, got, tc.want)
+		}
+	}
+}
+
+func TestWithNameMatcher(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	lf, err := New(path, WithNameMatcher(func(recorded, live string) bool { return false }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// never the expected process, so the lockfile is not busy
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithPathInErrors(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithPathInErrors())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = lf.Unlock()
+	if !errors.Is(err, ErrRogueDeletion) {
+		t.Fatalf("expected error %q, got %v", ErrRogueDeletion, err)
+	}
+	if !strings.Contains(err.Error(), path) {
+		t.Errorf("error %q doesn't name %q", err, path)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	err = lf.TryLock(name)
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected error %q, got %v", ErrBusy, err)
+	}
+	if want := fmt.Sprintf("lockfile %q: %v", path, ErrBusy); err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+	if !isTemporary(err) {
+		t.Errorf("error %q isn't temporary anymore", err)
+	}
+}
+
+func TestTryLockNoAutoReap(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithNoAutoReap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := lf.TryLock("main"); err != ErrBusy {
+		t.Fatalf("dead owner: expected error %q, got %v", ErrBusy, err)
+	}
+
+	if err := lf.ForceUnlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.ForceUnlock(); err != nil {
+		t.Fatalf("missing: unexpected error: %v", err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("cleared: unexpected error: %v", err)
+	}
+
+	// our own lock is no reason to be busy
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("relock: unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
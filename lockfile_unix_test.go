@@ -0,0 +1,255 @@
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris || aix
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris aix
+
+package lockfile
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithFileMode(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer syscall.Umask(syscall.Umask(0077))
+
+	lf, err := New(path, WithFileMode(0644))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fi.Mode().Perm(); got != 0644 {
+		t.Errorf("got mode %v, want %v", got, os.FileMode(0644))
+	}
+}
+
+func TestTryLockOnFifo(t *testing.T) {
+	path, err := filepath.Abs("test_lockfile.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unix.Mkfifo(path, 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lf.TryLock("main"); got != ErrNotRegularFile {
+		t.Fatalf("expected error %q, got %v", ErrNotRegularFile, got)
+	}
+
+	if _, got := lf.GetOwner(); got != ErrNotRegularFile {
+		t.Fatalf("expected error %q, got %v", ErrNotRegularFile, got)
+	}
+}
+
+func TestWithTempDir(t *testing.T) {
+	dir := t.TempDir()
+	tempDir := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tempDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "test.lck")
+	lf, err := New(path, WithTempDir(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if owner, err := lf.GetOwner(); err != nil || owner.Pid != os.Getpid() {
+		t.Fatalf("expected to own the lock, got %v, %v", owner, err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(tempDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 0 {
+		t.Fatalf("expected temporary files to be removed, got %v", names)
+	}
+}
+
+func TestWithTempDirCrossDevice(t *testing.T) {
+	dir := t.TempDir()
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := device(fi)
+
+	var other string
+	for _, candidate := range []string{"/dev/shm", "/proc", "/sys", "/dev"} {
+		fi, err := os.Stat(candidate)
+		if err != nil {
+			continue
+		}
+
+		if otherDev, ok := device(fi); ok && otherDev != dev {
+			other = candidate
+			break
+		}
+	}
+
+	if other == "" {
+		t.Skip("no directory on another filesystem found")
+	}
+
+	_, err = New(filepath.Join(dir, "test.lck"), WithTempDir(other))
+	if !errors.Is(err, ErrCrossDevice) {
+		t.Fatalf("expected error %q, got %v", ErrCrossDevice, err)
+	}
+}
+
+func TestTryLockReapsZombie(t *testing.T) {
+	cmd := exec.Command("true")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Wait()
+
+	// Until we wait for it, the exited child stays a zombie.
+	pid := cmd.Process.Pid
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		status, err := processStatus(pid)
+		if err == nil && len(status) > 0 && status[0] == "zombie" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Skipf("child %d didn't become a zombie: %v, %v", pid, status, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithZombieAsDead())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("true"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+}
+
+func TestEqualSymlinkedDir(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(filepath.Join(dir, "test.lck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(filepath.Join(link, "test.lck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !lf.Equal(other) {
+		t.Fatalf("expected %s and %s to be equal, got keys %q and %q", lf, other, lf.Key(), other.Key())
+	}
+
+	held := map[string]bool{lf.Key(): true}
+	if !held[other.Key()] {
+		t.Fatalf("expected key %q to be found", other.Key())
+	}
+}
+
+func TestWithResolveSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(filepath.Join(dir, "test.lck"), WithResolveSymlinks(), WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(filepath.Join(link, "test.lck"), WithResolveSymlinks(), WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lf.String() != other.String() || lf.Key() != other.Key() {
+		t.Fatalf("got paths %q and %q, keys %q and %q, want them to be the same", lf, other, lf.Key(), other.Key())
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if err := other.TryLock("main"); err != ErrBusy {
+		t.Fatalf("expected error %v, got %v", ErrBusy, err)
+	}
+
+	missing, err := New(filepath.Join(link, "missing", "test.lck"), WithResolveSymlinks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(link, "missing", "test.lck"); missing.String() != want {
+		t.Fatalf("got path %q in a missing directory, want %q", missing, want)
+	}
+}
+
+func TestWritabilityCheckReadOnlyDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root may write to read-only directories")
+	}
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	path := filepath.Join(dir, "test.lck")
+	if _, err := New(path, WithWritabilityCheck()); !errors.Is(err, ErrDirNotWritable) {
+		t.Fatalf("expected error %q, got %v", ErrDirNotWritable, err)
+	}
+
+	// Without the check, New doesn't notice.
+	if _, err := New(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
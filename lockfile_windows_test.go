@@ -0,0 +1,53 @@
+package lockfile
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestStatusDoesntBlockUnlock(t *testing.T) {
+	path, err := filepath.Abs("test_windows.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_, _ = reader.Status()
+				}
+			}
+		}()
+
+		err := lf.Unlock()
+		close(stop)
+		wg.Wait()
+
+		if err != nil {
+			t.Fatalf("%d: unlock while reading: %v", i, err)
+		}
+	}
+}
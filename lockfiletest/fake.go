@@ -0,0 +1,93 @@
+package lockfiletest
+
+import (
+	"context"
+	"github.com/nightlyone/lockfile"
+	"sync"
+)
+
+// FakeLocker is a lockfile.Locker, which doesn't touch the disk.
+// It returns the errors configured and records how it has been called.
+// The zero value succeeds to lock and unlock. It is safe for concurrent use.
+type FakeLocker struct {
+	TryLockErr error // returned by TryLock
+	LockErr    error // returned by Lock, if ctx isn't done yet
+	UnlockErr  error // returned by Unlock
+
+	mu       sync.Mutex
+	held     bool
+	tryLocks []string
+	locks    []string
+	unlocks  int
+}
+
+var _ lockfile.Locker = (*FakeLocker)(nil)
+
+// TryLock records the call and returns TryLockErr.
+func (f *FakeLocker) TryLock(expProcName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tryLocks = append(f.tryLocks, expProcName)
+	if f.TryLockErr == nil {
+		f.held = true
+	}
+	return f.TryLockErr
+}
+
+// Lock records the call and returns the error of ctx or LockErr.
+func (f *FakeLocker) Lock(ctx context.Context, expProcName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.locks = append(f.locks, expProcName)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.LockErr == nil {
+		f.held = true
+	}
+	return f.LockErr
+}
+
+// LockedByMe reports whether the last TryLock or Lock succeeded and Unlock hasn't been called since.
+func (f *FakeLocker) LockedByMe() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.held, nil
+}
+
+// Unlock records the call and returns UnlockErr.
+func (f *FakeLocker) Unlock() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.unlocks++
+	f.held = false
+	return f.UnlockErr
+}
+
+// TryLockCalls returns the names passed to TryLock so far.
+func (f *FakeLocker) TryLockCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.tryLocks...)
+}
+
+// LockCalls returns the names passed to Lock so far.
+func (f *FakeLocker) LockCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.locks...)
+}
+
+// UnlockCalls returns how often Unlock has been called so far.
+func (f *FakeLocker) UnlockCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.unlocks
+}
@@ -0,0 +1,67 @@
+package lockfiletest
+
+import (
+	"context"
+	"github.com/nightlyone/lockfile"
+	"reflect"
+	"testing"
+)
+
+func TestFakeLocker(t *testing.T) {
+	f := &FakeLocker{}
+
+	if err := f.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if held, err := f.LockedByMe(); err != nil || !held {
+		t.Fatalf("got %v, %v, want true, <nil>", held, err)
+	}
+
+	if err := f.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if held, err := f.LockedByMe(); err != nil || held {
+		t.Fatalf("got %v, %v, want false, <nil>", held, err)
+	}
+
+	f.TryLockErr = lockfile.ErrBusy
+	f.UnlockErr = lockfile.ErrRogueDeletion
+
+	if err := f.TryLock("other"); err != lockfile.ErrBusy {
+		t.Fatalf("expected error %q, got %v", lockfile.ErrBusy, err)
+	}
+	if held, _ := f.LockedByMe(); held {
+		t.Fatal("busy lock held")
+	}
+	if err := f.Unlock(); err != lockfile.ErrRogueDeletion {
+		t.Fatalf("expected error %q, got %v", lockfile.ErrRogueDeletion, err)
+	}
+
+	if got, want := f.TryLockCalls(), []string{"main", "other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got TryLock calls %q, want %q", got, want)
+	}
+	if got := f.UnlockCalls(); got != 2 {
+		t.Errorf("got %d Unlock calls, want 2", got)
+	}
+}
+
+func TestFakeLockerLock(t *testing.T) {
+	f := &FakeLocker{}
+
+	if err := f.Lock(context.Background(), "main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.Lock(ctx, "main"); err != context.Canceled {
+		t.Fatalf("expected error %q, got %v", context.Canceled, err)
+	}
+
+	if got, want := f.LockCalls(), []string{"main", "main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got Lock calls %q, want %q", got, want)
+	}
+	if got := f.TryLockCalls(); len(got) != 0 {
+		t.Errorf("got TryLock calls %q, want none", got)
+	}
+}
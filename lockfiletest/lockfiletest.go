@@ -0,0 +1,55 @@
+// Package lockfiletest helps testing code using package lockfile
+// by simulating lockfiles held by arbitrary processes or by replacing them with FakeLocker.
+package lockfiletest
+
+import (
+	"fmt"
+	"github.com/shirou/gopsutil/v4/process"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// WritePID writes a lockfile at path owned by pid.
+// Use os.Getpid() for a lockfile owned by the test itself and DeadPID for a stale one.
+func WritePID(t testing.TB, path string, pid int) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", pid)), 0666); err != nil {
+		t.Fatalf("cannot write lockfile %q: %v", path, err)
+	}
+}
+
+// HoldWithPID works like WritePID, but also removes the lockfile when the test finishes.
+func HoldWithPID(t testing.TB, path string, pid int) {
+	t.Helper()
+
+	WritePID(t, path, pid)
+	t.Cleanup(func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			t.Errorf("cannot remove lockfile %q: %v", path, err)
+		}
+	})
+}
+
+// DeadPID returns a pid not used by any running process.
+func DeadPID(t testing.TB) int {
+	t.Helper()
+
+	// Stay below the smallest pid_max around, so the pid is valid everywhere.
+	const maxPid = 4095
+
+	for pid := maxPid; pid > 1; pid-- {
+		exists, err := process.PidExists(int32(pid))
+		if err != nil {
+			t.Fatalf("cannot check pid %d: %v", pid, err)
+		}
+
+		if !exists {
+			return pid
+		}
+	}
+
+	t.Fatalf("all pids up to %d are used", maxPid)
+	return 0
+}
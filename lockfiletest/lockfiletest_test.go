@@ -0,0 +1,81 @@
+package lockfiletest
+
+import (
+	"github.com/nightlyone/lockfile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newLockfile(t *testing.T) lockfile.Lockfile {
+	path, err := filepath.Abs("test_lockfiletest.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := lockfile.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lf
+}
+
+func TestHoldWithPID(t *testing.T) {
+	lf := newLockfile(t)
+
+	t.Run("hold", func(t *testing.T) {
+		HoldWithPID(t, lf.String(), os.Getpid())
+
+		mine, err := lf.LockedByMe()
+		if err != nil || !mine {
+			t.Fatalf("got %v, %v, want true, <nil>", mine, err)
+		}
+	})
+
+	if _, err := os.Stat(lf.String()); !os.IsNotExist(err) {
+		t.Fatalf("lockfile %q should be removed after the test, got %v", lf, err)
+	}
+}
+
+func TestWritePID(t *testing.T) {
+	lf := newLockfile(t)
+
+	pid := os.Getppid()
+	WritePID(t, lf.String(), pid)
+	defer os.Remove(lf.String())
+
+	content, err := ioutil.ReadFile(lf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := strconv.Itoa(pid) + "\n"; string(content) != want {
+		t.Fatalf("got content %q, want %q", content, want)
+	}
+
+	proc, err := lf.GetOwner()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if proc.Pid != pid {
+		t.Fatalf("got owner %d, want %d", proc.Pid, pid)
+	}
+}
+
+func TestDeadPID(t *testing.T) {
+	lf := newLockfile(t)
+
+	HoldWithPID(t, lf.String(), DeadPID(t))
+
+	if _, err := lf.GetOwner(); err != lockfile.ErrDeadOwner {
+		t.Fatalf("expected error %q, got %v", lockfile.ErrDeadOwner, err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("stale lockfile should be reaped, got %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package lockfile
+
+// Logger receives warnings about likely misuse of this package.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger sends warnings to logger. Without it, warnings are dropped.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// warnf sends a warning to the configured logger, if any.
+func (l Lockfile) warnf(format string, v ...interface{}) {
+	if logger := l.options().logger; logger != nil {
+		logger.Printf(format, v...)
+	}
+}
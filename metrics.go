@@ -0,0 +1,28 @@
+package lockfile
+
+import "time"
+
+// Metrics receives events worth monitoring.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Conflict is called, when WithSoftMode let us acquire the lockfile at path held by the live owners pids.
+	Conflict(path string, pids []int)
+
+	// ObserveWaitDuration is called, when Lock, AcquireWithin or LockBlocking acquired the lock after waiting for d.
+	// An uncontended lock reports a d of about zero, so all calls together make up a histogram of contention latency.
+	ObserveWaitDuration(d time.Duration)
+}
+
+// WithMetrics reports events worth monitoring to m.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// observeWait reports to the Metrics given by WithMetrics, that we acquired the lock after waiting since start.
+func (l Lockfile) observeWait(start time.Time) {
+	if m := l.options().metrics; m != nil {
+		m.ObserveWaitDuration(l.options().clock.Now().Sub(start))
+	}
+}
@@ -0,0 +1,89 @@
+package lockfile
+
+import (
+	"context"
+	"sort"
+)
+
+// LockAll blocks until it holds the lockfiles at all paths at once or ctx is done.
+// It waits and retries like Lock does with opts, see WithBackoff and WithRetryable.
+//
+// The lockfiles are acquired in the order of their paths. If one of them is busy,
+// the ones acquired so far are released again before waiting, so LockAll never keeps
+// others waiting for a partial set and callers of LockAll don't deadlock each other.
+// Within this process, the lockfiles are kept apart like by WithInProcessRegistry.
+//
+// The returned unlock releases all lockfiles and returns the first error of doing so.
+func LockAll(ctx context.Context, procName string, paths []string, opts ...Option) (unlock func() error, err error) {
+	locks, err := newSorted(paths, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(locks) == 0 {
+		return func() error { return nil }, nil
+	}
+
+	var held []Lockfile
+	first := locks[0]
+	err = first.retry(ctx, first.options().clock.Now(), func() error {
+		var err error
+		if held, err = tryLockAll(locks, procName); err != nil {
+			_ = unlockAll(held)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error { return unlockAll(held) }, nil
+}
+
+// newSorted describes the lockfiles at paths, sorted by path and without duplicates.
+func newSorted(paths []string, opts []Option) ([]Lockfile, error) {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	opts = append(opts[:len(opts):len(opts)], WithInProcessRegistry())
+
+	locks := make([]Lockfile, 0, len(sorted))
+	for i, path := range sorted {
+		if i > 0 && path == sorted[i-1] {
+			continue
+		}
+
+		l, err := New(path, opts...)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+
+	return locks, nil
+}
+
+// tryLockAll tries to own all locks in order and returns the ones it owns.
+// It stops at the first error.
+func tryLockAll(locks []Lockfile, procName string) ([]Lockfile, error) {
+	held := make([]Lockfile, 0, len(locks))
+	for _, l := range locks {
+		if err := l.TryLock(procName); err != nil {
+			return held, err
+		}
+		held = append(held, l)
+	}
+
+	return held, nil
+}
+
+// unlockAll releases all locks in reverse order and returns the first error of doing so.
+func unlockAll(locks []Lockfile) error {
+	var first error
+	for i := len(locks) - 1; i >= 0; i-- {
+		if err := locks[i].Unlock(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
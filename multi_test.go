@@ -0,0 +1,141 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLockAll(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.lck"), filepath.Join(dir, "b.lck")
+
+	unlock, err := LockAll(context.Background(), "main", []string{b, a, b})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	held := HeldByThisProcess()
+	if !contains(held, a) || !contains(held, b) {
+		t.Fatalf("expected %s and %s to be held, got %v", a, b, held)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, path := range []string{a, b} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", path, err)
+		}
+	}
+}
+
+func TestLockAllContention(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.lck"), filepath.Join(dir, "b.lck")
+
+	holder, err := New(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := LockAll(ctx, "main", []string{a, b}); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %q, got %v", context.DeadlineExceeded, err)
+	}
+
+	// a has been acquired on each attempt, but must not be kept.
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to be held, got %v", a, err)
+	}
+	if contains(HeldByThisProcess(), a) {
+		t.Fatalf("%s is still held within this process", a)
+	}
+
+	type result struct {
+		unlock func() error
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		unlock, err := LockAll(context.Background(), "main", []string{a, b})
+		done <- result{unlock, err}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := holder.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("released: unexpected error: %v", res.err)
+		}
+		if err := res.unlock(); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockAll didn't acquire the released lock")
+	}
+}
+
+func TestLockAllInvalidPath(t *testing.T) {
+	if _, err := LockAll(context.Background(), "main", []string{"relative.lck"}); err != ErrNeedAbsPath {
+		t.Fatalf("expected error %q, got %v", ErrNeedAbsPath, err)
+	}
+}
+
+func TestLockAllOptions(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.lck"), filepath.Join(dir, "b.lck")
+
+	retryIO := func(err error) bool {
+		return isTemporary(err) || errors.Is(err, syscall.EIO)
+	}
+
+	// Waits like Lock does with the given backoff, clock and metrics.
+	metrics := &recordingMetrics{}
+	opts := []Option{
+		WithClock(newFakeClock()), withFilesystem(&flakyFS{failures: 2}), WithMetrics(metrics),
+		WithBackoff(ConstantBackoff{Delay: time.Second}), WithRetryable(retryIO),
+	}
+	unlock, err := LockAll(context.Background(), "main", []string{a, b}, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{2 * time.Second}; !reflect.DeepEqual(metrics.waits, want) {
+		t.Errorf("observed waits %v, want %v", metrics.waits, want)
+	}
+
+	// Doesn't retry what isn't retryable.
+	holder, err := New(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Unlock()
+
+	never := WithRetryable(func(error) bool { return false })
+	if _, err := LockAll(context.Background(), "main", []string{a, b}, never); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected error %q, got %v", ErrBusy, err)
+	}
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to be held, got %v", a, err)
+	}
+}
@@ -0,0 +1,38 @@
+package lockfile
+
+import "context"
+
+// NamedMutex is a mutex shared between processes by its name.
+// It is backed by a lockfile in the runtime directory of the user, see NewRuntimeLock,
+// so only processes of the same user agree on it.
+type NamedMutex struct {
+	lf Lockfile
+}
+
+// NewNamedMutex returns the mutex called name.
+// The name is sanitized to a single path name element.
+// Within this process, the mutex works like any other mutex, see WithInProcessRegistry.
+// Any live owner keeps the mutex, whatever program it runs.
+func NewNamedMutex(name string, opts ...Option) (*NamedMutex, error) {
+	base, err := sanitizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lf, err := NewRuntimeLock(base+LockfileExt, append([]Option{WithInProcessRegistry()}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NamedMutex{lf: lf}, nil
+}
+
+// Lock blocks until it owns the mutex or ctx is done like Lockfile.Lock does.
+func (m *NamedMutex) Lock(ctx context.Context) error {
+	return m.lf.Lock(ctx, "")
+}
+
+// Unlock releases the mutex.
+func (m *NamedMutex) Unlock() error {
+	return m.lf.Unlock()
+}
@@ -0,0 +1,78 @@
+package lockfile
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNamedMutex(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	first, err := NewNamedMutex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewNamedMutex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewNamedMutex("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Lock(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := second.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("same name: expected error %q, got %v", context.DeadlineExceeded, err)
+	}
+
+	if err := other.Lock(context.Background()); err != nil {
+		t.Fatalf("other name: unexpected error: %v", err)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.Lock(context.Background()); err != nil {
+		t.Fatalf("released: unexpected error: %v", err)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewNamedMutexInvalidName(t *testing.T) {
+	for _, name := range []string{"", "..", "  "} {
+		if _, err := NewNamedMutex(name); err != ErrInvalidName {
+			t.Errorf("%q: expected error %q, got %v", name, ErrInvalidName, err)
+		}
+	}
+}
+
+func TestNamedMutexHeldByOtherProgram(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	m, err := NewNamedMutex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Our parent runs another program than we do, but is alive all the same.
+	writeBusyLockfile(t, m.lf.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %q, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,79 @@
+package lockfile
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// watcher tells when a file might have been released, i.e. removed or replaced.
+type watcher struct {
+	f       *os.File
+	changed chan struct{}
+}
+
+// newWatcher watches the file name in dir via inotify.
+func newWatcher(dir, name string) (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	const mask = syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	// The file is non-blocking, so closing it stops a pending read.
+	w := &watcher{f: os.NewFile(uintptr(fd), "inotify"), changed: make(chan struct{}, 1)}
+	go w.run(name)
+
+	return w, nil
+}
+
+// run signals changes of the file name until the watcher is closed.
+func (w *watcher) run(name string) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + int(ev.Len)
+			if off > n {
+				break
+			}
+
+			if cString(buf[start:off]) != name {
+				continue
+			}
+
+			select {
+			case w.changed <- struct{}{}:
+			default:
+				// a wakeup is pending already
+			}
+		}
+	}
+}
+
+// cString returns the NUL padded string b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
+
+// Close stops watching.
+func (w *watcher) Close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,58 @@
+package lockfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// frozenClock never lets a wait end.
+type frozenClock struct {
+	*fakeClock
+}
+
+func (frozenClock) After(d time.Duration) <-chan time.Time { return nil }
+
+func TestLockBlockingWakesUpOnRelease(t *testing.T) {
+	path, err := filepath.Abs("test_notify.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	// Only a notification can make it try again.
+	lf, err := New(path, WithClock(frozenClock{newFakeClock()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lf.LockBlocking(ctx, name)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("acquired busy lock: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package lockfile
+
+import "errors"
+
+// watcher tells when a file might have been released, i.e. removed or replaced.
+type watcher struct {
+	changed chan struct{}
+}
+
+// newWatcher fails, as there is no support for watching files on this platform yet.
+func newWatcher(dir, name string) (*watcher, error) {
+	return nil, errors.New("watching files is not supported on this platform")
+}
+
+// Close stops watching.
+func (w *watcher) Close() error {
+	return nil
+}
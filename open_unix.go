@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris || aix
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris aix
+
+package lockfile
+
+import "os"
+
+// openShared opens the file name for reading.
+// Open files never keep others from removing or renaming them here.
+func openShared(name string) (*os.File, error) {
+	return os.Open(name)
+}
@@ -0,0 +1,23 @@
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// openShared opens the file name for reading without keeping others from removing or renaming it,
+// which os.Open does on Windows. So reading a lockfile never makes the Unlock of its owner fail.
+func openShared(name string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	const share = syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, share, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), name), nil
+}
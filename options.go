@@ -0,0 +1,360 @@
+package lockfile
+
+import (
+	"os"
+	"time"
+)
+
+// DefaultMaxFileSize is the size in bytes up to which a lockfile is read by default.
+const DefaultMaxFileSize = 4096
+
+// Option configures a Lockfile created by New.
+type Option func(*options)
+
+type options struct {
+	encoder LockEncoder
+	decoder LockDecoder
+
+	registry bool
+
+	clock        Clock
+	staleAfter   time.Duration
+	waitForStale bool
+
+	isRunning   func(pid int) (bool, error)
+	recheckBusy bool
+
+	timestamp bool
+	hostname  string
+
+	resolvePID func() (int, error)
+	pid        int // as resolved by New
+
+	maxFileSize int64
+
+	fs       filesystem
+	readOnly bool
+
+	logger          Logger
+	strictInstances bool
+
+	lockTimeout time.Duration // total wait of Lock, if > 0
+
+	matchName func(recorded, live string) bool
+
+	pathInErrors bool
+
+	invalidPidRetries    int
+	invalidPidRetryDelay time.Duration
+
+	noAutoReap bool
+
+	fairQueue bool
+
+	historyPath     string
+	historyMaxBytes int64
+	historyKeep     int
+
+	fileMode os.FileMode
+
+	tempDir string
+
+	unlockErrorHandler func(error)
+
+	zombieAsDead  bool
+	processStatus func(pid int) ([]string, error)
+
+	livenessCache *livenessCache
+
+	lockInsideDir bool
+
+	retryable func(error) bool
+
+	bootID string // as recorded in the lockfile, see WithRebootDetection
+
+	softMode bool
+	metrics  Metrics
+
+	processCheckTimeout time.Duration
+	customLiveness      bool // whether isRunning has been given by WithLivenessChecker
+
+	reapArchiveDir string
+
+	backoff Backoff
+
+	xattrMetadata bool
+
+	preReapHook func(LockInfo) error
+
+	revalidatePath bool
+
+	truncateName bool
+
+	emptyContent bool
+
+	resolveSymlinks bool
+
+	verifyLinkCount bool
+
+	leaseDeadline time.Duration
+
+	agent string
+
+	checkWritable bool
+
+	unlockDelay time.Duration
+
+	stateLogPath string
+
+	ioTimeout time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		encoder:    pidCodec{},
+		decoder:    pidCodec{},
+		clock:      realClock{},
+		isRunning:  isRunning,
+		resolvePID: getpid,
+		pid:        os.Getpid(),
+
+		maxFileSize: DefaultMaxFileSize,
+
+		fs: osFS{},
+
+		matchName: matchName,
+
+		invalidPidRetries:    2,
+		invalidPidRetryDelay: 5 * time.Millisecond,
+
+		processStatus: processStatus,
+
+		retryable: isTemporary,
+		backoff:   ExponentialBackoff{Min: minRetryDelay, Max: maxRetryDelay},
+	}
+}
+
+// getpid is the default of WithPIDResolver.
+func getpid() (int, error) {
+	return os.Getpid(), nil
+}
+
+// options returns the configuration of l, which is the default one for a Lockfile not made by New.
+func (l Lockfile) options() *options {
+	if l.opts == nil {
+		return defaultOptions()
+	}
+
+	return l.opts
+}
+
+// WithCodec stores the lockfile content in a format of your choice.
+// Both enc and dec must agree on that format.
+// By default the pid is written on a line of its own.
+func WithCodec(enc LockEncoder, dec LockDecoder) Option {
+	return func(o *options) {
+		o.encoder = enc
+		o.decoder = dec
+	}
+}
+
+// WithPidfileCompat writes nothing but the pid in decimal, without even a trailing newline,
+// so the lockfile also serves as a pidfile for tools choking on anything else.
+// All other information, like the fencing token of TryLockFenced, isn't recorded in the lockfile then.
+func WithPidfileCompat() Option {
+	return WithCodec(pidfileCodec{}, pidfileCodec{})
+}
+
+// WithFileMode creates lockfiles with the permissions mode regardless of the umask.
+// By default, lockfiles are only readable and writable by their owner.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.fileMode = mode
+	}
+}
+
+// WithTempDir writes the temporary files, which become the lockfile, to dir instead of next to the lockfile.
+// As they are linked to the lockfile, dir must be on the same filesystem, which New checks.
+// If not, New returns ErrCrossDevice.
+func WithTempDir(dir string) Option {
+	return func(o *options) {
+		o.tempDir = dir
+	}
+}
+
+// DirLockName is the name of the lockfile used by WithLockInsideDirectory.
+const DirLockName = ".lock"
+
+// WithLockInsideDirectory makes New use the lockfile DirLockName within path, if path is a directory.
+// By default, New returns ErrIsDirectory then.
+// A directory created at path after New is still reported as ErrIsDirectory.
+func WithLockInsideDirectory() Option {
+	return func(o *options) {
+		o.lockInsideDir = true
+	}
+}
+
+// WithResolveSymlinks makes New resolve symlinks in the directory of the lockfile,
+// so Lockfiles reaching the same lockfile through different symlinks have the same path name.
+// Otherwise, WithInProcessRegistry and WithStrictInstances, which go by the path name, consider them distinct.
+// The lockfile itself, which might not exist yet, is not resolved.
+func WithResolveSymlinks() Option {
+	return func(o *options) {
+		o.resolveSymlinks = true
+	}
+}
+
+// WithClock replaces the clock used to tell the age of lockfiles and to wait.
+// This is meant for tests.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithStaleAfter considers a lockfile stale once it is older than d, even if its owner is alive.
+// TryLock reaps such a lockfile like one of a dead owner.
+func WithStaleAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.staleAfter = d
+	}
+}
+
+// WithWaitForStale makes TryLock wait until a lockfile held by a live owner
+// becomes stale due to WithStaleAfter and then try once more.
+// Without WithStaleAfter, this option has no effect.
+func WithWaitForStale() Option {
+	return func(o *options) {
+		o.waitForStale = true
+	}
+}
+
+// WithLivenessChecker replaces how to tell whether the process with a given pid is running.
+func WithLivenessChecker(isRunning func(pid int) (bool, error)) Option {
+	return func(o *options) {
+		o.isRunning = isRunning
+		o.customLiveness = true
+	}
+}
+
+// WithBusyRecheck makes TryLock check a live owner once more before returning ErrBusy.
+// If the lockfile still names the same owner, which exited meanwhile, the lockfile is reaped instead.
+// This narrows the window, in which an owner exiting right after our check is reported as busy,
+// but cannot close it: The owner may still exit right after the second check.
+func WithBusyRecheck() Option {
+	return func(o *options) {
+		o.recheckBusy = true
+	}
+}
+
+// WithTimestamp records when the lock has been acquired in the lockfile.
+// Age prefers this over the modification time of the lockfile,
+// which backups or rsync might have changed.
+func WithTimestamp() Option {
+	return func(o *options) {
+		o.timestamp = true
+	}
+}
+
+// WithHostAware records the hostname in the lockfile, so lockfiles on a filesystem shared between hosts work.
+// Lockfiles of owners on other hosts are considered busy, as we cannot tell whether their owner is still running.
+// Lockfiles without a hostname are handled as before.
+func WithHostAware() Option {
+	return func(o *options) {
+		o.hostname, _ = os.Hostname()
+	}
+}
+
+// WithHostname works like WithHostAware, but uses name instead of os.Hostname.
+// This is useful for tests and hosts with unstable hostnames.
+func WithHostname(name string) Option {
+	return func(o *options) {
+		o.hostname = name
+	}
+}
+
+// WithPIDResolver replaces how New finds out the pid to record in the lockfile and to check for ownership.
+// The default is os.Getpid.
+//
+// Inside a container, os.Getpid returns the pid within its pid namespace.
+// Such a pid may belong to a totally unrelated process on the host or within another container,
+// so lockfiles on volumes shared between them become meaningless. Callers knowing the pid
+// of this process as seen by all others can provide it via resolve.
+// The liveness checks must then also work on such pids, see WithLivenessChecker.
+func WithPIDResolver(resolve func() (int, error)) Option {
+	return func(o *options) {
+		o.resolvePID = resolve
+	}
+}
+
+// WithMaxFileSize limits the size in bytes up to which a lockfile is read.
+// Larger ones are reported as ErrOversizeLockfile instead of being parsed,
+// as a correct lockfile is tiny and anything else hints at a misconfiguration.
+func WithMaxFileSize(n int64) Option {
+	return func(o *options) {
+		o.maxFileSize = n
+	}
+}
+
+// WithReadOnly makes TryLock usable for diagnostics on filesystems we cannot write to, like a squashfs layer.
+// If writing the lockfile fails there, TryLock still returns ErrBusy for a live owner,
+// but ErrReadOnlyFS for a lock it would acquire otherwise.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// WithNameMatcher replaces how TryLock tells whether the live owner of a lockfile is the expected process.
+// It is called with the name passed to TryLock and the name of the live process, unless the former is empty.
+// The default ignores case, accepts names containing the expected one
+// and tolerates the truncation of process names by Linux.
+func WithNameMatcher(match func(recorded, live string) bool) Option {
+	return func(o *options) {
+		o.matchName = match
+	}
+}
+
+// WithInvalidPidRetries makes TryLock read a lockfile without a valid pid up to n more times,
+// waiting delay in between, before it considers the lock free and replaces the lockfile.
+// Another process might just be writing it and would lose its lock otherwise.
+// The default are 2 retries 5ms apart. Use n = 0 to replace such lockfiles right away.
+func WithInvalidPidRetries(n int, delay time.Duration) Option {
+	return func(o *options) {
+		o.invalidPidRetries = n
+		o.invalidPidRetryDelay = delay
+	}
+}
+
+// WithNoAutoReap makes TryLock return ErrBusy for every lockfile naming another owner,
+// even if that owner isn't running anymore or the lock is stale due to WithStaleAfter or TryLockTTL.
+// Such locks must be cleared explicitly via ForceUnlock instead.
+// This is meant for coordination, where a wrong verdict of "dead" would be worse than a lock never freed.
+// Lockfiles without a valid pid are still replaced.
+func WithNoAutoReap() Option {
+	return func(o *options) {
+		o.noAutoReap = true
+	}
+}
+
+// WithPathInErrors returns errors of acquiring and releasing the lock as *PathError,
+// so logs dealing with several lockfiles tell them apart.
+// Use errors.Is instead of == to check for the errors of this package then.
+func WithPathInErrors() Option {
+	return func(o *options) {
+		o.pathInErrors = true
+	}
+}
+
+// wrapErr returns err as *PathError with WithPathInErrors.
+func (l Lockfile) wrapErr(err error) error {
+	if err == nil || !l.options().pathInErrors {
+		return err
+	}
+
+	if _, ok := err.(*PathError); ok {
+		return err
+	}
+
+	return &PathError{Path: l.name, Err: err}
+}
@@ -0,0 +1,68 @@
+package lockfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+const (
+	maxNameLen = 255  // NAME_MAX of common filesystems in bytes
+	maxPathLen = 4096 // PATH_MAX of Linux in bytes, which is among the largest
+
+	hashedNameLen = 16 // hex digits of the hash replacing the end of a truncated name
+	tempRandomLen = 10 // most digits ioutil.TempFile appends to the prefix of a temporary file
+)
+
+// WithTruncatedName makes New shorten a name of the lockfile too long for the filesystem
+// instead of returning ErrPathTooLong. The end of such a name is replaced by a hash of the whole name,
+// keeping its extension, so the shortened names of different lockfiles still differ.
+// Directories too long are still reported as ErrPathTooLong.
+func WithTruncatedName() Option {
+	return func(o *options) {
+		o.truncateName = true
+	}
+}
+
+// fitPath returns path, if it isn't too long to name a lockfile.
+// Otherwise it returns ErrPathTooLong or, if truncate is set, path with a shortened name.
+func fitPath(path string, truncate bool) (string, error) {
+	dir, base := filepath.Split(path)
+	if len(base) > maxNameLen {
+		if !truncate {
+			return "", fmt.Errorf("%w: name has %d bytes, at most %d are supported", ErrPathTooLong, len(base), maxNameLen)
+		}
+		path = dir + truncateName(base, maxNameLen)
+	}
+
+	if len(path) > maxPathLen {
+		return "", fmt.Errorf("%w: path has %d bytes, at most %d are supported", ErrPathTooLong, len(path), maxPathLen)
+	}
+
+	return path, nil
+}
+
+// truncateName shortens base to max bytes, if it is longer, replacing its end by a hash of base.
+// Files named after the lockfile use it to fit their suffix.
+func truncateName(base string, max int) string {
+	if len(base) <= max {
+		return base
+	}
+
+	ext := filepath.Ext(base)
+	if len(ext) > hashedNameLen {
+		ext = ""
+	}
+
+	sum := sha256.Sum256([]byte(base))
+	hash := hex.EncodeToString(sum[:])[:hashedNameLen]
+
+	keep := max - len(ext) - len(hash) - 1
+	for keep > 0 && !utf8.RuneStart(base[keep]) {
+		keep--
+	}
+
+	return base[:keep] + "-" + hash + ext
+}
@@ -0,0 +1,101 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPathTooLong(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, strings.Repeat("x", 300)+LockfileExt)
+
+	if _, err := New(path); !errors.Is(err, ErrPathTooLong) {
+		t.Fatalf("expected error %v, got %v", ErrPathTooLong, err)
+	}
+
+	long := filepath.Join(dir, strings.Repeat(strings.Repeat("d", 200)+string(filepath.Separator), 25), "test.lck")
+	if _, err := New(long, WithTruncatedName()); !errors.Is(err, ErrPathTooLong) {
+		t.Fatalf("expected error %v for a long directory, got %v", ErrPathTooLong, err)
+	}
+}
+
+func TestTruncatedName(t *testing.T) {
+	dir := t.TempDir()
+	prefix := strings.Repeat("x", 300)
+
+	lf, err := New(filepath.Join(dir, prefix+"a"+LockfileExt), WithTruncatedName())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Base(lf.String())
+	if len(base) > maxNameLen || !strings.HasSuffix(base, LockfileExt) {
+		t.Fatalf("got name %q of %d bytes, want at most %d ending in %q", base, len(base), maxNameLen, LockfileExt)
+	}
+
+	again, err := New(filepath.Join(dir, prefix+"a"+LockfileExt), WithTruncatedName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != lf.String() {
+		t.Fatalf("got %q for the same name, want %q", again, lf)
+	}
+
+	other, err := New(filepath.Join(dir, prefix+"b"+LockfileExt), WithTruncatedName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.String() == lf.String() {
+		t.Fatalf("got %q for different names", lf)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTruncateNameKeepsRunes(t *testing.T) {
+	base := strings.Repeat("ä", 200)
+	got := truncateName(base, maxNameLen)
+
+	if len(got) > maxNameLen || !utf8.ValidString(got) {
+		t.Fatalf("got %q of %d bytes, want valid UTF-8 of at most %d", got, len(got), maxNameLen)
+	}
+}
+
+func TestLongNameArchived(t *testing.T) {
+	dir := t.TempDir()
+	archive := t.TempDir()
+	path := filepath.Join(dir, strings.Repeat("x", maxNameLen-len(LockfileExt))+LockfileExt)
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithReapArchive(archive))
+	if err != nil {
+		t.Fatalf("got %v for a name of %d bytes, want <nil>", err, maxNameLen)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	archived, err := ioutil.ReadDir(archive)
+	if err != nil || len(archived) != 1 {
+		t.Fatalf("got %d archived lockfiles, %v, want 1, <nil>", len(archived), err)
+	}
+}
@@ -0,0 +1,30 @@
+package lockfile
+
+import "os"
+
+// WithPreReapHook calls hook with what the lockfile records about its owner and with its RenewalCount,
+// right before TryLock reaps the lockfile of a dead owner or a stale one.
+// If hook returns an error, the lockfile is left alone and TryLock returns that error.
+// This is the last chance to veto reaping or to fence off the old owner, e.g. in external storage.
+// Lockfiles without a valid pid and the ones naming us are replaced without calling hook.
+func WithPreReapHook(hook func(owner LockInfo) error) Option {
+	return func(o *options) {
+		o.preReapHook = hook
+	}
+}
+
+// preReap calls the hook given by WithPreReapHook before reaping the lockfile of owner.
+func (l Lockfile) preReap(owner LockInfo) error {
+	hook := l.options().preReapHook
+	if hook == nil {
+		return nil
+	}
+
+	renewals, err := l.renewals(owner)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	owner.Renewals = renewals
+
+	return hook(owner)
+}
@@ -0,0 +1,84 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreReapHookVetoes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	content := fmt.Sprintf("%d\n", GetDeadPID())
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	veto := errors.New("fencing failed")
+	lf, err := New(path, WithPreReapHook(func(LockInfo) error {
+		return veto
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != veto {
+		t.Fatalf("got error %v, want %v", err, veto)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != content {
+		t.Fatalf("got content %q, want %q", got, content)
+	}
+}
+
+func TestPreReapHookSeesDeadOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	dead := GetDeadPID()
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", dead)), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var owners []int
+	lf, err := New(path, WithPreReapHook(func(owner LockInfo) error {
+		owners = append(owners, owner.PID)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	if len(owners) != 1 || owners[0] != dead {
+		t.Fatalf("hook called with pids %v, want [%d]", owners, dead)
+	}
+}
+
+func TestPreReapHookSkipsInvalidPid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	if err := ioutil.WriteFile(path, []byte("\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithPreReapHook(func(LockInfo) error {
+		t.Error("hook called for a lockfile without a valid pid")
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+}
@@ -0,0 +1,82 @@
+package lockfile
+
+import (
+	"context"
+	"fmt"
+	"github.com/shirou/gopsutil/v4/process"
+	"time"
+)
+
+// WithProcessCheckTimeout bounds each check of the owner, i.e. whether it is running and its name, by d.
+// A check taking longer fails with an error wrapping context.DeadlineExceeded, which Lock retries.
+// The checks of gopsutil are given a context, which is canceled then. A check ignoring it
+// finishes in the background without blocking anything.
+// With it, the default liveness check is done by gopsutil.
+func WithProcessCheckTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.processCheckTimeout = d
+	}
+}
+
+// probe is the result of checking a process.
+type probe struct {
+	running bool
+	name    string
+	err     error
+}
+
+// checkProcess runs check with a context bounded by WithProcessCheckTimeout.
+// Without a timeout, check runs right away.
+func (l Lockfile) checkProcess(pid int, check func(ctx context.Context) probe) probe {
+	timeout := l.options().processCheckTimeout
+	if timeout <= 0 {
+		return check(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// buffered, so the check can finish after we gave up on it
+	done := make(chan probe, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case p := <-done:
+		return p
+	case <-ctx.Done():
+		return probe{err: fmt.Errorf("lockfile: checking pid %d: %w", pid, ctx.Err())}
+	}
+}
+
+// checkRunning tells whether the process pid is running using the configured liveness checker.
+func (l Lockfile) checkRunning(pid int) (bool, error) {
+	o := l.options()
+	p := l.checkProcess(pid, func(ctx context.Context) probe {
+		if o.processCheckTimeout > 0 && !o.customLiveness {
+			running, err := process.PidExistsWithContext(ctx, int32(pid))
+			return probe{running: running, err: err}
+		}
+
+		running, err := o.isRunning(pid)
+		return probe{running: running, err: err}
+	})
+
+	return p.running, p.err
+}
+
+// processName returns the name of the process pid.
+func (l Lockfile) processName(pid int) (string, error) {
+	p := l.checkProcess(pid, func(ctx context.Context) probe {
+		proc, err := process.NewProcessWithContext(ctx, int32(pid))
+		if err != nil {
+			return probe{err: err}
+		}
+
+		name, err := proc.NameWithContext(ctx)
+		return probe{name: name, err: err}
+	})
+
+	return p.name, p.err
+}
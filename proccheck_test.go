@@ -0,0 +1,107 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitForGoroutines waits up to a second for the number of goroutines to drop to n.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if runtime.NumGoroutine() <= n {
+			return
+		}
+	}
+
+	t.Fatalf("%d goroutines leaked", runtime.NumGoroutine()-n)
+}
+
+func TestWithProcessCheckTimeout(t *testing.T) {
+	path, err := filepath.Abs("test_proccheck.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	hanging := func(pid int) (bool, error) {
+		<-release
+		return true, nil
+	}
+
+	lf, err := New(path, WithLivenessChecker(hanging), WithProcessCheckTimeout(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if _, err := lf.isRunning(42); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%d: expected error %q, got %v", i, context.DeadlineExceeded, err)
+		}
+	}
+
+	// The abandoned checks finish once the checker returns.
+	close(release)
+	waitForGoroutines(t, before)
+}
+
+func TestWithProcessCheckTimeoutNoLeaks(t *testing.T) {
+	path, err := filepath.Abs("test_proccheck.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithProcessCheckTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countFds := func() int {
+		fds, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			return 0
+		}
+		return len(fds)
+	}
+
+	goroutines, fds := runtime.NumGoroutine(), countFds()
+	for i := 0; i < 100; i++ {
+		_, _ = lf.isRunning(os.Getppid())
+		_, _ = lf.processName(os.Getppid())
+	}
+
+	waitForGoroutines(t, goroutines)
+	if got := countFds(); got > fds {
+		t.Fatalf("%d file descriptors leaked", got-fds)
+	}
+}
+
+func TestWithProcessCheckTimeoutSucceeds(t *testing.T) {
+	path, err := filepath.Abs("test_proccheck.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithProcessCheckTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if running, err := lf.isRunning(os.Getppid()); err != nil || !running {
+		t.Fatalf("got %v, %v, want true, <nil>", running, err)
+	}
+	if running, err := lf.isRunning(GetDeadPID()); err != nil || running {
+		t.Fatalf("dead pid: got %v, %v, want false, <nil>", running, err)
+	}
+	if name, err := lf.processName(os.Getpid()); err != nil || name == "" {
+		t.Fatalf("got name %q, %v", name, err)
+	}
+}
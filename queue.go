@@ -0,0 +1,219 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WithFairQueue makes Lock hand out the lock in the order callers started to wait for it.
+// Each waiter adds a marker file named after the lockfile plus ".wait.<seq>" next to it
+// and only the waiter with the lowest sequence number tries to acquire the lock.
+// So early waiters don't starve, while late ones are lucky to poll right after a release.
+// The highest sequence number handed out is kept in a ".waitseq" file, so numbers only grow.
+// Markers of waiters, which aren't running anymore, are removed.
+// Markers in a format we cannot decode, e.g. of waiters using another codec, are left alone.
+// Callers of TryLock and of Lock without this option still jump the queue.
+func WithFairQueue() Option {
+	return func(o *options) {
+		o.fairQueue = true
+	}
+}
+
+// waitPrefix returns the prefix of the names of the wait markers for the lockfile name.
+func waitPrefix(name string) string {
+	return name + ".wait."
+}
+
+// waitSeqName returns the name of the file keeping the highest sequence number handed out for the lockfile name.
+func waitSeqName(name string) string {
+	return name + ".waitseq"
+}
+
+// enqueue adds a marker for us to the waiters for the lock and returns its sequence number.
+func (l Lockfile) enqueue() (uint64, error) {
+	data, err := l.options().encoder.Encode(l.newInfo())
+	if err != nil {
+		return 0, err
+	}
+
+	// Linking a complete file makes sure, nobody sees a marker without content.
+	tmp, cleanup, err := l.makePidFile(data)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cleanup()
+
+	var taken uint64 // highest sequence number found taken by a marker
+	for {
+		seqs, err := l.waiters()
+		if err != nil {
+			return 0, err
+		}
+
+		last, err := l.readWaitSeq()
+		if err != nil {
+			return 0, err
+		}
+		if len(seqs) > 0 && seqs[len(seqs)-1] > last {
+			last = seqs[len(seqs)-1]
+		}
+		if taken > last {
+			last = taken
+		}
+		seq := last + 1
+
+		err = l.fs().Link(tmp, waitPrefix(l.name)+strconv.FormatUint(seq, 10))
+		if err == nil {
+			// Concurrent waiters might write a lower number in between, which is then handed out again.
+			// As its waiter is gone by then, it still lines up behind all others waiting.
+			if err := l.writeWaitSeq(seq); err != nil {
+				l.dequeue(seq)
+				return 0, err
+			}
+			return seq, nil
+		}
+
+		// someone else took this place, so line up behind it
+		if !os.IsExist(err) {
+			return 0, err
+		}
+		taken = seq
+	}
+}
+
+// readWaitSeq returns the highest sequence number handed out so far.
+func (l Lockfile) readWaitSeq() (uint64, error) {
+	content, err := readShared(l.fs(), waitSeqName(l.name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+
+	return seq, nil
+}
+
+// writeWaitSeq atomically records seq as the highest sequence number handed out, unless a higher one is known.
+func (l Lockfile) writeWaitSeq(seq uint64) error {
+	last, err := l.readWaitSeq()
+	if err != nil || last >= seq {
+		return err
+	}
+
+	tmp, cleanup, err := l.makeTempFile(waitSeqName(l.name), []byte(strconv.FormatUint(seq, 10)+"\n"))
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	return l.fs().Rename(tmp, waitSeqName(l.name))
+}
+
+// dequeue removes our marker with sequence number seq from the waiters for the lock.
+func (l Lockfile) dequeue(seq uint64) {
+	_ = l.fs().Remove(waitPrefix(l.name) + strconv.FormatUint(seq, 10))
+}
+
+// waiters returns the sequence numbers of the waiters for the lock, lowest first.
+// It removes the markers of waiters, which aren't running anymore, and skips the ones it cannot decode.
+func (l Lockfile) waiters() ([]uint64, error) {
+	prefix := filepath.Base(waitPrefix(l.name))
+
+	fis, err := ioutil.ReadDir(filepath.Dir(l.name))
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []uint64
+	for _, fi := range fis {
+		if !strings.HasPrefix(fi.Name(), prefix) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimPrefix(fi.Name(), prefix), 10, 64)
+		if err != nil || seq == 0 {
+			continue
+		}
+
+		marker := filepath.Join(filepath.Dir(l.name), fi.Name())
+		live, err := l.isWaiting(marker)
+		if err == errUndecodableMarker {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !live {
+			_ = l.fs().Remove(marker)
+			continue
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// errUndecodableMarker reports a wait marker in a format we cannot decode.
+var errUndecodableMarker = errors.New("lockfile: cannot decode wait marker")
+
+// isWaiting reports whether the waiter recorded in marker is still running.
+// Waiters on other hosts are assumed to be running.
+// A marker, which cannot be decoded, is reported as errUndecodableMarker.
+func (l Lockfile) isWaiting(marker string) (bool, error) {
+	content, err := readShared(l.fs(), marker)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	info, err := l.options().decoder.Decode(content)
+	if err != nil || info.PID <= 0 {
+		return false, errUndecodableMarker
+	}
+
+	if l.isForeign(info) {
+		return true, nil
+	}
+
+	return l.isRunning(info.PID)
+}
+
+// tryLockQueued tries to acquire the lock for the waiter with sequence number seq.
+// Waiters behind others get ErrBusy.
+func (l Lockfile) tryLockQueued(seq uint64, expProcName string) error {
+	seqs, err := l.waiters()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range seqs {
+		if s < seq {
+			return ErrBusy
+		}
+	}
+
+	if len(seqs) == 0 || seqs[0] != seq {
+		return fmt.Errorf("wait marker %d for %q vanished", seq, l.name)
+	}
+
+	return l.TryLock(expProcName)
+}
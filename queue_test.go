@@ -0,0 +1,185 @@
+package lockfile
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForWaiters waits until n waiters queue for lf.
+func waitForWaiters(t *testing.T, lf Lockfile, n int) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(time.Millisecond) {
+		seqs, err := lf.waiters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seqs) == n {
+			return
+		}
+	}
+	t.Fatalf("%d waiters didn't show up", n)
+}
+
+func TestFairQueue(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.lck")
+
+	// Different hosts keep the locks of this process apart.
+	holder, err := New(path, WithHostname("holder"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := holder.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 4
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < n; i++ {
+		waiter, err := New(path, WithHostname("waiter"+strconv.Itoa(i)), WithFairQueue())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if err := waiter.Lock(ctx, "main"); err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+				return
+			}
+
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+
+			if err := waiter.Unlock(); err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			}
+		}(i)
+
+		// enqueue one after the other
+		waitForWaiters(t, holder, i+1)
+	}
+
+	if err := holder.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got order %v, want %v", order, want)
+	}
+
+	if seqs, err := holder.waiters(); err != nil || len(seqs) != 0 {
+		t.Errorf("got waiters %v, %v, want none", seqs, err)
+	}
+}
+
+func TestFairQueueRemovesDeadWaiters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.lck")
+
+	// a waiter, which died while waiting
+	marker := waitPrefix(path) + "1"
+	if err := ioutil.WriteFile(marker, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithFairQueue())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := lf.Lock(ctx, "main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("marker of dead waiter still exists: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFairQueueSeqGrows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.lck")
+
+	lf, err := New(path, WithFairQueue())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last uint64
+	for i := 0; i < 3; i++ {
+		seq, err := lf.enqueue()
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if seq <= last {
+			t.Fatalf("%d: got sequence number %d after %d", i, seq, last)
+		}
+		last = seq
+
+		// The queue is empty afterwards, but the next waiter still lines up behind.
+		lf.dequeue(seq)
+	}
+}
+
+func TestFairQueueKeepsUndecodableMarkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.lck")
+
+	// a waiter using a format we don't understand
+	marker := waitPrefix(path) + "1"
+	if err := ioutil.WriteFile(marker, []byte("owner: someone\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithFairQueue())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seqs, err := lf.waiters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seqs) != 0 {
+		t.Errorf("got waiters %v, want none", seqs)
+	}
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("marker of unknown format has been removed: %v", err)
+	}
+
+	// Its sequence number isn't handed out again.
+	seq, err := lf.enqueue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.dequeue(seq)
+	if seq != 2 {
+		t.Errorf("got sequence number %d, want 2", seq)
+	}
+}
@@ -0,0 +1,166 @@
+package lockfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LockfileExt is the extension of lockfiles looked at by the functions handling whole directories.
+const LockfileExt = ".lck"
+
+// ReapStaleInDir removes all lockfiles in dir, whose owner is not running anymore.
+// Only files ending in LockfileExt are considered.
+// Lockfiles of owners on other hosts are left alone, as we cannot tell whether they are running, see WithHostAware.
+// The lockfiles are read with opts, e.g. WithCodec or WithLivenessChecker.
+func ReapStaleInDir(dir string, opts ...Option) error {
+	return ReapStaleInDirContext(context.Background(), dir, nil, opts...)
+}
+
+// ReapStaleInDirContext works like ReapStaleInDir, but stops once ctx is done and returns its error then.
+// If onReap is not nil, it is called with the path and the dead owner of each lockfile removed.
+// Lockfiles owned by running processes or which cannot be parsed are left alone.
+func ReapStaleInDirContext(ctx context.Context, dir string, onReap func(path string, deadPID int), opts ...Option) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(fi.Name(), LockfileExt) {
+			continue
+		}
+
+		path, err := filepath.Abs(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+
+		pid, err := reapStale(path, opts)
+		if err != nil {
+			return err
+		}
+
+		if pid != 0 && onReap != nil {
+			onReap(path, pid)
+		}
+	}
+
+	return nil
+}
+
+// WalkDir calls fn with the Status of each lockfile in dir, e.g. to list them.
+// Only regular files ending in LockfileExt are considered, in lexical order.
+// Lockfiles which cannot be parsed are passed as Corrupt instead of stopping the walk.
+// If fn returns an error, WalkDir stops and returns it.
+// The lockfiles are read with opts like ReapStaleInDir does, so those of owners on other hosts are Alive.
+func WalkDir(dir string, fn func(status LockStatus) error, opts ...Option) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(fi.Name(), LockfileExt) {
+			continue
+		}
+
+		path, err := filepath.Abs(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+
+		l, err := newInDir(path, opts)
+		if err != nil {
+			return err
+		}
+
+		status, err := l.Status()
+		if err != nil && !status.Corrupt {
+			return err
+		}
+
+		if err := fn(status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newInDir returns the Lockfile path for the functions handling whole directories.
+// They are aware of the hostname, unless opts say otherwise.
+func newInDir(path string, opts []Option) (Lockfile, error) {
+	return New(path, append([]Option{WithHostAware()}, opts...)...)
+}
+
+// reapStale removes the lockfile at path, if its owner is not running anymore, and returns that owner.
+// It returns 0 for lockfiles it leaves alone.
+func reapStale(path string, opts []Option) (int, error) {
+	l, err := newInDir(path, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	inspected, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	info, err := l.readInfo()
+	switch {
+	case err == nil:
+	case os.IsNotExist(err):
+		return 0, nil
+	case err == ErrInvalidPid, err == ErrIsDirectory, err == ErrNotRegularFile, err == ErrOversizeLockfile:
+		// not ours to judge
+		return 0, nil
+	default:
+		return 0, err
+	}
+
+	if l.isForeign(info) {
+		return 0, nil
+	}
+
+	running, err := l.isRunning(info.PID)
+	if err != nil || running {
+		return 0, err
+	}
+
+	removed, err := l.removeStale(inspected)
+	if err != nil || !removed {
+		return 0, err
+	}
+
+	return info.PID, nil
+}
+
+// removeStale removes the lockfile of a dead owner, unless it isn't the one inspected anymore,
+// e.g. as someone else reaped it and acquired the lock meanwhile. It reports whether it did.
+func (l Lockfile) removeStale(inspected os.FileInfo) (bool, error) {
+	current, err := os.Lstat(l.name)
+	if err != nil || !sameInstance(inspected, current) {
+		return false, nil
+	}
+
+	_ = l.fs().Remove(renewalsName(l.name))
+	if err := l.fs().Remove(l.name); err != nil {
+		if os.IsNotExist(err) {
+			// someone else was faster
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,173 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeLockfiles writes a file for each name and pid to dir.
+func writeLockfiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// remainingFiles returns the names of the files in dir.
+func remainingFiles(t *testing.T, dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func TestReapStaleInDirContext(t *testing.T) {
+	dir := t.TempDir()
+
+	dead := GetDeadPID()
+	writeLockfiles(t, dir, map[string]string{
+		"dead.lck":          fmt.Sprintf("%d\n", dead),
+		"dead.lck.renewals": fmt.Sprintf("pid=%d\nrenewals=3\n", dead),
+		"junk.lck":          "junk\n",
+		"live.lck":          fmt.Sprintf("%d\n", os.Getppid()),
+		"other.txt":         fmt.Sprintf("%d\n", dead),
+		"foreign.lck":       fmt.Sprintf("%d\nhost=elsewhere.invalid\n", dead),
+	})
+
+	reaped := map[string]int{}
+	err := ReapStaleInDirContext(context.Background(), dir, func(path string, deadPID int) {
+		reaped[filepath.Base(path)] = deadPID
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := map[string]int{"dead.lck": dead}; !reflect.DeepEqual(reaped, want) {
+		t.Errorf("got reaped %v, want %v", reaped, want)
+	}
+
+	if got, want := remainingFiles(t, dir), []string{"foreign.lck", "junk.lck", "live.lck", "other.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got remaining files %v, want %v", got, want)
+	}
+}
+
+func TestReapStaleInDirContextCanceled(t *testing.T) {
+	dir := t.TempDir()
+
+	dead := fmt.Sprintf("%d\n", GetDeadPID())
+	writeLockfiles(t, dir, map[string]string{"a.lck": dead, "b.lck": dead})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := ReapStaleInDirContext(ctx, dir, func(path string, deadPID int) {
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected error %q, got %v", context.Canceled, err)
+	}
+
+	if got, want := remainingFiles(t, dir), []string{"b.lck"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got remaining files %v, want %v", got, want)
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	dir := t.TempDir()
+
+	dead := GetDeadPID()
+	writeLockfiles(t, dir, map[string]string{
+		"dead.lck":   fmt.Sprintf("%d\n", dead),
+		"junk.lck":   "junk\n",
+		"live.lck":   fmt.Sprintf("%d\n", os.Getppid()),
+		"mine.lck":   fmt.Sprintf("%d\n", os.Getpid()),
+		"other.txt":  fmt.Sprintf("%d\n", dead),
+		"remote.lck": fmt.Sprintf("%d\nhost=elsewhere.invalid\n", dead),
+	})
+	if err := os.Mkdir(filepath.Join(dir, "sub.lck"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		PID     int
+		Alive   bool
+		Corrupt bool
+	}
+
+	var names []string
+	got := map[string]summary{}
+	err := WalkDir(dir, func(status LockStatus) error {
+		name := filepath.Base(status.Path)
+		names = append(names, name)
+		got[name] = summary{PID: status.PID, Alive: status.Alive, Corrupt: status.Corrupt}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"dead.lck", "junk.lck", "live.lck", "mine.lck", "remote.lck"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got lockfiles %v, want %v", names, want)
+	}
+
+	want := map[string]summary{
+		"dead.lck": {PID: dead},
+		"junk.lck": {Corrupt: true},
+		"live.lck": {PID: os.Getppid(), Alive: true},
+		"mine.lck": {PID: os.Getpid(), Alive: true},
+		// We cannot tell whether an owner on another host is running.
+		"remote.lck": {PID: dead, Alive: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = WalkDir(dir, func(status LockStatus) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("got error %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestReapStaleInDirReplaced(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+	writeLockfiles(t, dir, map[string]string{"test.lck": fmt.Sprintf("%d\n", GetDeadPID())})
+
+	// Someone reaps the lockfile and acquires the lock, while we check its owner.
+	checker := WithLivenessChecker(func(pid int) (bool, error) {
+		writeLockfiles(t, dir, map[string]string{"new.tmp": fmt.Sprintf("%d\n", os.Getppid())})
+		if err := os.Rename(filepath.Join(dir, "new.tmp"), path); err != nil {
+			t.Fatal(err)
+		}
+		return pid == os.Getppid(), nil
+	})
+
+	err := ReapStaleInDirContext(context.Background(), dir, func(path string, deadPID int) {
+		t.Errorf("reaped %s of %d", path, deadPID)
+	}, checker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := remainingFiles(t, dir), []string{"test.lck"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got remaining files %v, want %v", got, want)
+	}
+}
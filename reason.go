@@ -0,0 +1,38 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TryLockWithReason works like TryLock, but also records why we take the lock,
+// so operators know what they interrupt by clearing it.
+// If the lock is busy, the error returned also tells the reason of the owner, if it recorded one.
+// Use errors.Is to check for ErrBusy then.
+func (l Lockfile) TryLockWithReason(expProcName, reason string) error {
+	err := l.acquire(expProcName, func() (LockInfo, error) {
+		info := l.newInfo()
+		info.Reason = reason
+		return info, nil
+	})
+	if !errors.Is(err, ErrBusy) {
+		return err
+	}
+
+	if owner, rerr := l.readInfo(); rerr == nil && owner.Reason != "" {
+		return l.wrapErr(fmt.Errorf("%w: held for %q", ErrBusy, owner.Reason))
+	}
+
+	return err
+}
+
+// Reason returns why the lock has been acquired.
+// Lockfiles written without a reason, like the ones of TryLock, report an empty one.
+func (l Lockfile) Reason() (string, error) {
+	info, err := l.readInfo()
+	if err != nil {
+		return "", err
+	}
+
+	return info.Reason, nil
+}
@@ -0,0 +1,96 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTryLockWithReason(t *testing.T) {
+	path, err := filepath.Abs("test_reason.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const reason = "DB migration v42"
+	if err := lf.TryLockWithReason("main", reason); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := lf.Reason()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != reason {
+		t.Fatalf("got reason %q, want %q", got, reason)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTryLockWithReasonBusy(t *testing.T) {
+	path, err := filepath.Abs("test_reason.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	// the owner recorded no reason
+	if got := lf.TryLockWithReason(name, "backup"); got != ErrBusy {
+		t.Fatalf("expected error %q, got %v", ErrBusy, got)
+	}
+
+	content := fmt.Sprintf("%d\nreason=%s\n", os.Getppid(), strconv.Quote("DB migration v42"))
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	got := lf.TryLockWithReason(name, "backup")
+	if !errors.Is(got, ErrBusy) {
+		t.Fatalf("expected error %q, got %v", ErrBusy, got)
+	}
+	if !strings.Contains(got.Error(), `held for "DB migration v42"`) {
+		t.Fatalf("error %q lacks the reason of the owner", got)
+	}
+}
+
+func TestReasonOfLegacyLockfile(t *testing.T) {
+	path, err := filepath.Abs("test_reason.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	got, err := lf.Reason()
+	if err != nil || got != "" {
+		t.Fatalf("got %q, %v, want \"\", <nil>", got, err)
+	}
+}
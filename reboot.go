@@ -0,0 +1,38 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// bootIDPath is where Linux tells the random id of the current boot.
+const bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// WithRebootDetection records the id of the current boot in the lockfile.
+// A lockfile of this host recorded during an earlier boot is stale, as its owner died with the reboot,
+// even if its pid has been reused since. This matters for lockfiles on persistent storage;
+// those on a tmpfs like /run vanish with the reboot anyway.
+// Lockfiles without a boot id are handled as before.
+// On filesystems shared between hosts, use WithHostAware as well, as other hosts boot with other ids.
+// Only Linux tells the boot id, elsewhere this option has no effect.
+func WithRebootDetection() Option {
+	return func(o *options) {
+		o.bootID = readBootID()
+	}
+}
+
+// readBootID returns the id of the current boot or "", if it is unknown.
+func readBootID() string {
+	content, err := ioutil.ReadFile(bootIDPath)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// rebootedSince reports whether the lock recorded as info has been acquired during an earlier boot of this host.
+func (l Lockfile) rebootedSince(info LockInfo) bool {
+	bootID := l.options().bootID
+	return bootID != "" && info.BootID != "" && info.BootID != bootID && !l.isForeign(info)
+}
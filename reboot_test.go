@@ -0,0 +1,75 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withBootID works like WithRebootDetection, but uses id as the id of the current boot.
+func withBootID(id string) Option {
+	return func(o *options) {
+		o.bootID = id
+	}
+}
+
+func TestWithRebootDetection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	tests := [...]struct {
+		recorded string // boot id in the lockfile of our live parent
+		xfail    error
+	}{
+		{recorded: "earlier"},
+		{recorded: "current", xfail: ErrBusy},
+		{recorded: "", xfail: ErrBusy},
+	}
+
+	for step, tc := range tests {
+		name := writeBusyLockfile(t, path)
+		content := fmt.Sprintf("%d\n", os.Getppid())
+		if tc.recorded != "" {
+			content += "boot=" + tc.recorded + "\n"
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		lf, err := New(path, withBootID("current"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.TryLock(name); err != tc.xfail {
+			t.Fatalf("%d: expected error %v, got %v", step, tc.xfail, err)
+		}
+		if tc.xfail != nil {
+			continue
+		}
+
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("%d\nboot=current\n", os.Getpid()); string(got) != want {
+			t.Fatalf("%d: got content %q, want %q", step, got, want)
+		}
+
+		if err := lf.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadBootID(t *testing.T) {
+	if _, err := os.Stat(bootIDPath); err != nil {
+		t.Skip("no boot id on this platform")
+	}
+
+	first, second := readBootID(), readBootID()
+	if first == "" || first != second {
+		t.Fatalf("got boot ids %q and %q, want the same non-empty one", first, second)
+	}
+}
@@ -0,0 +1,284 @@
+package lockfile
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// state is shared by all copies of a Lockfile made by New.
+type state struct {
+	held bool // guarded by registry
+
+	// identity of the lockfile while held, nil if unknown; guarded by registry.
+	// Its modification time serves as a marker of the very instance we created, see replaced.
+	file os.FileInfo
+
+	inherited *os.File // descriptor of the lockfile adopted via AdoptFromEnv, if any; guarded by registry
+
+	transferred int // pid the lock has been transferred to via Transfer, 0 if none; guarded by registry
+
+	// when the age of the lock held started to count, as measured by the clock of this process;
+	// zero if unknown; guarded by registry
+	since time.Time
+
+	conflicted []int // pids of the owners ignored by the last TryLock, see WithSoftMode; guarded by registry
+
+	dir os.FileInfo // directory of the lockfile while held, see WithRevalidatePath; guarded by registry
+
+	flocked *os.File // descriptor holding the flock of the lockfile, see WithEmptyContent; guarded by registry
+
+	// closed to stop watching the lease of the lock held, see WithLeaseDeadline; guarded by registry
+	leaseStop chan struct{}
+	renewed   time.Time // when the lease has been renewed last; guarded by registry
+
+	// closed once the lockfile left in place by Unlock is taken back, see WithUnlockDelay; guarded by registry
+	lingering  chan struct{}
+	lingerFile os.FileInfo   // identity of that lockfile, see replaced; guarded by registry
+	unlinger   chan struct{} // closed once removeLingering is done removing that lockfile; guarded by registry
+}
+
+// registry tracks which lockfiles are held within this process, keyed by absolute path.
+var registry = struct {
+	sync.Mutex
+	holders map[string]*state
+}{holders: map[string]*state{}}
+
+// WithInProcessRegistry makes TryLock check the lockfiles held within this process first.
+// If another Lockfile of this process holds the same path, ErrBusy is returned
+// without touching the filesystem. Otherwise the lockfile is handled as usual,
+// so locking between processes stays safe.
+func WithInProcessRegistry() Option {
+	return func(o *options) {
+		o.registry = true
+	}
+}
+
+// WithStrictInstances makes New and TryLock return ErrDuplicateInstance,
+// if another Lockfile of this process holds the same path.
+// By default, this is only reported as a warning to the logger given by WithLogger,
+// as locking and unlocking such Lockfiles independently ends in ErrRogueDeletion sooner or later.
+// Copies of a Lockfile don't count as another one.
+func WithStrictInstances() Option {
+	return func(o *options) {
+		o.strictInstances = true
+	}
+}
+
+// checkDuplicate warns about another Lockfile of this process holding the same path as l
+// or reports it as ErrDuplicateInstance with WithStrictInstances.
+func (l Lockfile) checkDuplicate() error {
+	if !heldElsewhere(l.name, l.st) {
+		return nil
+	}
+
+	if l.options().strictInstances {
+		return ErrDuplicateInstance
+	}
+
+	l.warnf("lockfile: %s is already held by another Lockfile of this process", l.name)
+	return nil
+}
+
+// HeldByThisProcess returns the absolute paths of all lockfiles currently held by this process, sorted.
+// Only locks acquired through Lockfiles made by New are known.
+// This is meant for logging at shutdown.
+func HeldByThisProcess() []string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	var paths []string
+	for name, st := range registry.holders {
+		if st.held {
+			paths = append(paths, name)
+		}
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// heldElsewhere reports whether another Lockfile than st holds name.
+func heldElsewhere(name string, st *state) bool {
+	registry.Lock()
+	defer registry.Unlock()
+
+	holder := registry.holders[name]
+	return holder != nil && holder != st && holder.held
+}
+
+// reserve claims name for st. It reports false, if another Lockfile holds name,
+// and whether the claim is new and must be given up, if the lockfile cannot be acquired.
+func reserve(name string, st *state) (ok, fresh bool) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	switch registry.holders[name] {
+	case nil:
+		registry.holders[name] = st
+		return true, true
+	case st:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// hold records that st holds name, which is the file currently found there.
+func hold(name string, st *state) {
+	file := identityOf(name)
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if prev := registry.holders[name]; prev != nil {
+		prev.held = false
+	}
+	registry.holders[name] = st
+	st.held = true
+	st.file = file
+	st.transferred = 0
+	st.since = time.Time{}
+}
+
+// identify records that the lock held by st is now kept in the file currently found at name,
+// after we changed or replaced the lockfile ourselves.
+func identify(name string, st *state) {
+	file := identityOf(name)
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if st.held {
+		st.file = file
+	}
+}
+
+// touch records that the age of the lock held by st counts from now.
+func touch(st *state, now time.Time) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if st.held {
+		st.since = now
+	}
+}
+
+// heldSince returns when the age of the lock held by st started to count or the zero time, if unknown.
+func heldSince(st *state) time.Time {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if !st.held {
+		return time.Time{}
+	}
+
+	return st.since
+}
+
+// release records that st doesn't hold name anymore.
+func release(name string, st *state) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.holders[name] == st {
+		delete(registry.holders, name)
+	}
+	st.held = false
+	st.file = nil
+	st.dir = nil
+
+	if st.leaseStop != nil {
+		close(st.leaseStop)
+		st.leaseStop = nil
+	}
+
+	// The adopted descriptor served to hold the lock, so it goes with the lock.
+	if st.inherited != nil {
+		_ = st.inherited.Close()
+		st.inherited = nil
+	}
+	// Closing the descriptor releases the flock, see WithEmptyContent.
+	if st.flocked != nil {
+		_ = st.flocked.Close()
+		st.flocked = nil
+	}
+}
+
+// transfer records that st gave up holding name to the process pid.
+func transfer(name string, st *state, pid int) {
+	release(name, st)
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	st.transferred = pid
+}
+
+// transferredTo returns the pid the lock of st has been transferred to, 0 if none.
+func transferredTo(st *state) int {
+	registry.Lock()
+	defer registry.Unlock()
+
+	return st.transferred
+}
+
+// setConflicts records the pids of the owners ignored by the last acquisition of st.
+func setConflicts(st *state, pids []int) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	st.conflicted = pids
+}
+
+// conflicts returns the pids of the owners ignored by the last acquisition of st, nil if none.
+func conflicts(st *state) []int {
+	registry.Lock()
+	defer registry.Unlock()
+
+	return st.conflicted
+}
+
+// replaced reports whether the file found at name isn't the one st acquired anymore.
+// That is another file, even if its inode number has been reused, or the same file written by someone else.
+// A missing file hasn't been replaced.
+func replaced(name string, st *state) bool {
+	registry.Lock()
+	held := st.file
+	registry.Unlock()
+
+	return replacedSince(name, held)
+}
+
+// replacedSince reports whether the file name isn't the very file held anymore, see replaced.
+func replacedSince(name string, held os.FileInfo) bool {
+	if held == nil {
+		return false
+	}
+
+	current, err := os.Lstat(name)
+	if err != nil {
+		return false
+	}
+
+	return !sameInstance(held, current)
+}
+
+// sameInstance reports whether current is the very file held, not just the same inode written anew.
+func sameInstance(held, current os.FileInfo) bool {
+	return os.SameFile(held, current) && current.ModTime().Equal(held.ModTime())
+}
+
+// identityOf returns what tells the file name apart from all others for replaced, nil if unknown.
+func identityOf(name string) os.FileInfo {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return nil
+	}
+
+	// Some platforms look up what tells files apart by the path name on first use,
+	// so do it now, before another file could take its place.
+	os.SameFile(fi, fi)
+	return fi
+}
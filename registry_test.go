@@ -0,0 +1,269 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestInProcessRegistry(t *testing.T) {
+	path, err := filepath.Abs("test_registry.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 16
+	locks := make([]Lockfile, n)
+	for i := range locks {
+		if locks[i], err = New(path, WithInProcessRegistry()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range locks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = locks[i].TryLock("main")
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch err {
+		case nil:
+			if winner >= 0 {
+				t.Fatalf("both lock %d and %d acquired %q", winner, i, path)
+			}
+			winner = i
+		case ErrBusy:
+		default:
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+	}
+
+	if winner < 0 {
+		t.Fatalf("no lock acquired %q", path)
+	}
+
+	if err := locks[winner].Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// released locks are free for others again
+	other := locks[(winner+1)%n]
+	if err := other.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInProcessRegistryAllowsRelock(t *testing.T) {
+	path, err := filepath.Abs("test_registry.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordingLogger records all warnings.
+type recordingLogger struct {
+	warnings []string
+}
+
+func (r *recordingLogger) Printf(format string, v ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, v...))
+}
+
+func TestDuplicateInstanceWarning(t *testing.T) {
+	path, err := filepath.Abs("test_registry.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &recordingLogger{}
+
+	lf, err := New(path, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := New(path, WithLogger(logger), WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	// copies are the same Lockfile
+	lfCopy := lf
+	if err := lfCopy.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.warnings) != 0 {
+		t.Fatalf("unexpected warnings: %q", logger.warnings)
+	}
+
+	if _, err := New(path, WithLogger(logger)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(logger.warnings) != 1 {
+		t.Fatalf("expected a warning about constructing a duplicate, got %q", logger.warnings)
+	}
+
+	if err := other.TryLock("main"); err != ErrBusy {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(logger.warnings) != 2 {
+		t.Fatalf("expected a warning about locking a duplicate, got %q", logger.warnings)
+	}
+}
+
+func TestDuplicateInstanceStrict(t *testing.T) {
+	path, err := filepath.Abs("test_registry.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := New(path, WithStrictInstances())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	if _, err := New(path, WithStrictInstances()); err != ErrDuplicateInstance {
+		t.Errorf("New: expected error %q, got %v", ErrDuplicateInstance, err)
+	}
+
+	if err := other.TryLock("main"); err != ErrDuplicateInstance {
+		t.Errorf("TryLock: expected error %q, got %v", ErrDuplicateInstance, err)
+	}
+}
+
+// contains reports whether paths contains path.
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestHeldByThisProcess(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.lck"), filepath.Join(dir, "second.lck")
+
+	a, err := New(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [...]struct {
+		do            func() error
+		first, second bool
+	}{
+		{do: func() error { return a.TryLock("main") }, first: true},
+		{do: func() error { return b.TryLock("main") }, first: true, second: true},
+		{do: a.Unlock, second: true},
+		{do: b.Unlock},
+	}
+
+	for step, tc := range tests {
+		if err := tc.do(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+
+		held := HeldByThisProcess()
+		if got := contains(held, first); got != tc.first {
+			t.Errorf("%d: expected %s held %v, got %v", step, first, tc.first, held)
+		}
+		if got := contains(held, second); got != tc.second {
+			t.Errorf("%d: expected %s held %v, got %v", step, second, tc.second, held)
+		}
+	}
+}
+
+func TestCloseAfterRogueDeletion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(path, WithInProcessRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Unlock(); err != ErrRogueDeletion {
+		t.Fatalf("expected error %q, got %v", ErrRogueDeletion, err)
+	}
+
+	if err := other.TryLock("main"); err != ErrBusy {
+		t.Fatalf("before Close: expected error %q, got %v", ErrBusy, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := lf.Close(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+	}
+
+	if contains(HeldByThisProcess(), path) {
+		t.Fatalf("%s is still held after Close", path)
+	}
+
+	if err := other.TryLock("main"); err != nil {
+		t.Fatalf("after Close: unexpected error: %v", err)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
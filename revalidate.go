@@ -0,0 +1,66 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WithRevalidatePath makes Refresh and Unlock check, whether the directory of the lockfile
+// is still the one it has been in, when TryLock acquired the lock.
+// If the directory has been remounted, e.g. by bind mounts changing underneath a container,
+// or replaced meanwhile, they return ErrDirChanged instead of operating on whatever is found there now.
+// Functions only reading the lockfile, like Status, always look it up by its path anew.
+func WithRevalidatePath() Option {
+	return func(o *options) {
+		o.revalidatePath = true
+	}
+}
+
+// recordDir remembers the directory of the lockfile just acquired for checkDir.
+func (l Lockfile) recordDir() {
+	if l.st == nil || !l.options().revalidatePath {
+		return
+	}
+
+	fi, err := l.fs().Stat(filepath.Dir(l.name))
+	if err != nil {
+		// We cannot tell without, so we don't check later.
+		return
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if l.st.held {
+		l.st.dir = fi
+	}
+}
+
+// checkDir returns ErrDirChanged, if the directory of the lockfile isn't the one recorded by recordDir anymore.
+func (l Lockfile) checkDir() error {
+	if l.st == nil || !l.options().revalidatePath {
+		return nil
+	}
+
+	registry.Lock()
+	recorded := l.st.dir
+	registry.Unlock()
+
+	if recorded == nil {
+		return nil
+	}
+
+	fi, err := l.fs().Stat(filepath.Dir(l.name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrDirChanged
+		}
+		return err
+	}
+
+	if !os.SameFile(recorded, fi) {
+		return ErrDirChanged
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// remountFS is a filesystem, whose directories turn into others once remounted is set,
+// like after a remount giving them another device id.
+type remountFS struct {
+	osFS
+	remounted string // directory found instead of all others, if not empty
+}
+
+func (fs *remountFS) Stat(name string) (os.FileInfo, error) {
+	if fs.remounted != "" {
+		name = fs.remounted
+	}
+
+	return fs.osFS.Stat(name)
+}
+
+func TestRevalidatePath(t *testing.T) {
+	tests := [...]struct {
+		revalidate bool
+		remount    bool
+		err        error
+	}{
+		{},
+		{remount: true},
+		{revalidate: true},
+		{revalidate: true, remount: true, err: ErrDirChanged},
+	}
+
+	for step, tc := range tests {
+		path := filepath.Join(t.TempDir(), "test.lck")
+
+		fs := &remountFS{}
+		opts := []Option{withFilesystem(fs)}
+		if tc.revalidate {
+			opts = append(opts, WithRevalidatePath())
+		}
+
+		lf, err := New(path, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+
+		if tc.remount {
+			fs.remounted = t.TempDir()
+		}
+
+		if err := lf.Refresh(); err != tc.err {
+			t.Errorf("%d: Refresh: expected error %v, got %v", step, tc.err, err)
+		}
+
+		if err := lf.Unlock(); err != tc.err {
+			t.Errorf("%d: Unlock: expected error %v, got %v", step, tc.err, err)
+		}
+
+		_, err = os.Stat(path)
+		if exists, want := !os.IsNotExist(err), tc.err != nil; exists != want {
+			t.Errorf("%d: lockfile exists %v, want %v", step, exists, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultDir is the directory set by SetDefaultDir.
+var defaultDir struct {
+	sync.RWMutex
+	dir string
+}
+
+// NewRuntimeLock describes a lockfile called name in the runtime directory of the user.
+// That is $XDG_RUNTIME_DIR or, if it isn't set to an absolute path, os.TempDir().
+// The name is sanitized to a single path name element.
+// Names too long are reported as ErrPathTooLong, unless shortened via WithTruncatedName.
+func NewRuntimeLock(name string, opts ...Option) (Lockfile, error) {
+	base, err := sanitizeName(name)
+	if err != nil {
+		return Lockfile{}, err
+	}
+
+	return New(filepath.Join(runtimeDir(), base), opts...)
+}
+
+// NewPortLock describes the lockfile coordinating the instances binding the TCP or UDP port,
+// so only one of them gets to bind it. It is called like the port in the runtime directory of the user,
+// see NewRuntimeLock, so all processes of the user agree on it without configuration.
+// Within this process, the lock works like any other mutex, see WithInProcessRegistry.
+func NewPortLock(port int, opts ...Option) (Lockfile, error) {
+	if port < 1 || port > 65535 {
+		return Lockfile{}, fmt.Errorf("invalid port %d", port)
+	}
+
+	return NewRuntimeLock(fmt.Sprintf("port-%d%s", port, LockfileExt), append([]Option{WithInProcessRegistry()}, opts...)...)
+}
+
+// FromEnv describes the lockfile at the path given by the environment variable envVar.
+// An unset or empty variable is reported as ErrEmptyPath naming the variable.
+func FromEnv(envVar string, opts ...Option) (Lockfile, error) {
+	path := os.Getenv(envVar)
+	if strings.TrimSpace(path) == "" {
+		return Lockfile{}, fmt.Errorf("%w: environment variable %s is unset or empty", ErrEmptyPath, envVar)
+	}
+
+	return New(path, opts...)
+}
+
+// SetDefaultDir sets the directory of the lockfiles described by NewInDefault.
+// It is safe for concurrent use.
+func SetDefaultDir(dir string) {
+	defaultDir.Lock()
+	defer defaultDir.Unlock()
+
+	defaultDir.dir = dir
+}
+
+// NewInDefault describes a lockfile called name in the directory set by SetDefaultDir.
+// The name is sanitized to a single path name element like by NewRuntimeLock.
+// If no directory has been set, ErrNoDefaultDir is returned.
+func NewInDefault(name string, opts ...Option) (Lockfile, error) {
+	defaultDir.RLock()
+	dir := defaultDir.dir
+	defaultDir.RUnlock()
+
+	if dir == "" {
+		return Lockfile{}, ErrNoDefaultDir
+	}
+
+	base, err := sanitizeName(name)
+	if err != nil {
+		return Lockfile{}, err
+	}
+
+	return New(filepath.Join(dir, base), opts...)
+}
+
+// runtimeDir returns the directory for per-user runtime files like lockfiles.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return os.TempDir()
+}
+
+// sanitizeName turns name into a single path name element,
+// replacing everything except ASCII letters, digits, '.', '-' and '_' by '_'.
+func sanitizeName(name string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(name))
+
+	if base == "" || base == "." || base == ".." {
+		return "", ErrInvalidName
+	}
+
+	return base, nil
+}
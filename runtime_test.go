@@ -0,0 +1,180 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewRuntimeLock(t *testing.T) {
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+
+	runtime := filepath.Join(os.TempDir(), "runtime")
+
+	tests := [...]struct {
+		dir  string
+		want string
+	}{
+		{dir: runtime, want: filepath.Join(runtime, "app.lck")},
+		{dir: "", want: filepath.Join(os.TempDir(), "app.lck")},
+		{dir: "relative", want: filepath.Join(os.TempDir(), "app.lck")},
+	}
+
+	for step, tc := range tests {
+		os.Setenv("XDG_RUNTIME_DIR", tc.dir)
+
+		lf, err := NewRuntimeLock("app.lck")
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+
+		if got := lf.String(); got != tc.want {
+			t.Errorf("%d: got path %q, want %q", step, got, tc.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	const envVar = "LOCKFILE_TEST_PATH"
+	defer os.Unsetenv(envVar)
+
+	path := filepath.Join(os.TempDir(), "app.lck")
+
+	tests := [...]struct {
+		value string
+		unset bool
+		err   error
+	}{
+		{value: path},
+		{unset: true, err: ErrEmptyPath},
+		{value: " ", err: ErrEmptyPath},
+		{value: "relative.lck", err: ErrNeedAbsPath},
+		{value: os.TempDir(), err: ErrIsDirectory},
+	}
+
+	for step, tc := range tests {
+		if tc.unset {
+			os.Unsetenv(envVar)
+		} else {
+			os.Setenv(envVar, tc.value)
+		}
+
+		lf, err := FromEnv(envVar)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%d: expected error %v, got %v", step, tc.err, err)
+		}
+
+		if err == nil && lf.String() != tc.value {
+			t.Errorf("%d: got path %q, want %q", step, lf.String(), tc.value)
+		}
+	}
+}
+
+func TestNewInDefault(t *testing.T) {
+	defer SetDefaultDir("")
+
+	if _, err := NewInDefault("app.lck"); err != ErrNoDefaultDir {
+		t.Fatalf("unset: expected error %q, got %v", ErrNoDefaultDir, err)
+	}
+
+	dir := filepath.Join(os.TempDir(), "locks")
+	SetDefaultDir(dir)
+
+	tests := [...]struct {
+		name string
+		want string
+	}{
+		{name: "app.lck", want: filepath.Join(dir, "app.lck")},
+		{name: "db/backup", want: filepath.Join(dir, "db_backup")},
+		{name: "..", want: ""},
+	}
+
+	for step, tc := range tests {
+		lf, err := NewInDefault(tc.name)
+		if tc.want == "" {
+			if err != ErrInvalidName {
+				t.Errorf("%d: expected error %q, got %v", step, ErrInvalidName, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+
+		if got := lf.String(); got != tc.want {
+			t.Errorf("%d: got path %q, want %q", step, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := [...]struct {
+		name  string
+		want  string
+		xfail error
+	}{
+		{name: "app.lck", want: "app.lck"},
+		{name: " my app ", want: "my_app"},
+		{name: "../../etc/passwd", want: ".._.._etc_passwd"},
+		{name: "a/b\\c:d", want: "a_b_c_d"},
+		{name: "süß", want: "s__"},
+		{name: "", xfail: ErrInvalidName},
+		{name: "   ", xfail: ErrInvalidName},
+		{name: ".", xfail: ErrInvalidName},
+		{name: "..", xfail: ErrInvalidName},
+	}
+
+	for step, tc := range tests {
+		got, err := sanitizeName(tc.name)
+		if err != tc.xfail {
+			t.Errorf("%d: expected error %v, got %v", step, tc.xfail, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("%d: got %q, want %q", step, got, tc.want)
+		}
+	}
+}
+
+func TestNewPortLock(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	first, err := NewPortLock(8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewPortLock(8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewPortLock(8081)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !first.Equal(second) || first.Equal(other) {
+		t.Fatalf("got paths %q, %q and %q, want the same for the same port only", first, second, other)
+	}
+
+	if err := first.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer first.Unlock()
+
+	if err := second.TryLock("main"); err != ErrBusy {
+		t.Fatalf("expected error %v for the same port, got %v", ErrBusy, err)
+	}
+
+	if err := other.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error for another port: %v", err)
+	}
+	defer other.Unlock()
+
+	for _, port := range []int{0, -1, 65536} {
+		if _, err := NewPortLock(port); err == nil {
+			t.Errorf("port %d: expected error", port)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package lockfile
+
+// WithSoftMode makes TryLock succeed, even if a live owner holds the lock.
+// Such a conflict is reported as a warning to the logger given by WithLogger,
+// to the Metrics given by WithMetrics and via ConflictedWith.
+// The lockfile of the owner is left alone, so Unlock leaves it alone as well.
+//
+// This is meant to run several instances side by side during a migration
+// and to validate that locking would have kept them apart before enforcing it.
+func WithSoftMode() Option {
+	return func(o *options) {
+		o.softMode = true
+	}
+}
+
+// ConflictedWith returns the pids of the live owners, which TryLock ignored due to WithSoftMode
+// on its last call, or nil if there were none.
+func (l Lockfile) ConflictedWith() []int {
+	if l.st == nil {
+		return nil
+	}
+
+	return conflicts(l.st)
+}
+
+// softConflict records that TryLock ignored the live owner of the lockfile due to WithSoftMode.
+func (l Lockfile) softConflict() error {
+	pid := l.options().pid
+	if info, err := l.readInfo(); err == nil {
+		pid = info.PID
+	}
+	// Otherwise another Lockfile of this process holds the lock, see WithInProcessRegistry.
+
+	pids := []int{pid}
+	setConflicts(l.st, pids)
+
+	l.warnf("lockfile: %s is held by pid %d, but acquired anyway in soft mode", l.name, pid)
+	if m := l.options().metrics; m != nil {
+		m.Conflict(l.name, pids)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics records the events reported to it.
+type recordingMetrics struct {
+	mu        sync.Mutex
+	conflicts map[string][]int
+	waits     []time.Duration
+}
+
+func (m *recordingMetrics) Conflict(path string, pids []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conflicts == nil {
+		m.conflicts = map[string][]int{}
+	}
+	m.conflicts[path] = pids
+}
+
+func (m *recordingMetrics) ObserveWaitDuration(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.waits = append(m.waits, d)
+}
+
+func TestWithSoftMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	name := writeBusyLockfile(t, path)
+
+	logger := &recordingLogger{}
+	metrics := &recordingMetrics{}
+	lf, err := New(path, WithSoftMode(), WithLogger(logger), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []int{os.Getppid()}
+	if got := lf.ConflictedWith(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got conflicts %v, want %v", got, want)
+	}
+	if got := metrics.conflicts[path]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got reported conflicts %v, want %v", got, want)
+	}
+	if len(logger.warnings) != 1 {
+		t.Fatalf("expected one warning, got %q", logger.warnings)
+	}
+
+	// The lockfile of the owner is left alone.
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(os.Getppid()) + "\n"; string(content) != want {
+		t.Fatalf("got content %q, want %q", content, want)
+	}
+}
+
+func TestWithSoftModeWithoutConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithSoftMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := lf.ConflictedWith(); got != nil {
+		t.Fatalf("got conflicts %v, want none", got)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected lockfile to be removed, got %v", err)
+	}
+}
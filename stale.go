@@ -0,0 +1,308 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Clock tells the time and waits for it to pass.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Age returns how long ago the lock has been acquired.
+// This is the time recorded via WithTimestamp or else the modification time of the lockfile.
+// Both are wall clock times, so steps of the system clock, e.g. by NTP or after resuming a VM,
+// make locks of other processes look older or younger than they are.
+// The age of a lock held by l itself is measured by the monotonic clock of this process instead,
+// so l never considers its own lock stale due to such a step.
+func (l Lockfile) Age() (time.Duration, error) {
+	fi, err := os.Stat(l.name)
+	if err != nil {
+		return 0, err
+	}
+
+	// An invalid lockfile still has a modification time.
+	info, err := l.readInfo()
+	if err != nil && err != ErrInvalidPid {
+		return 0, err
+	}
+
+	return l.age(fi, info), nil
+}
+
+// age returns how long ago the lock recorded as info in the lockfile described by fi has been acquired.
+func (l Lockfile) age(fi os.FileInfo, info LockInfo) time.Duration {
+	since := fi.ModTime()
+	if !info.Acquired.IsZero() {
+		since = info.Acquired
+	}
+
+	// Times of this process carry a monotonic clock reading, so their difference is immune to clock steps.
+	if l.st != nil && l.isMine(info) {
+		if held := heldSince(l.st); !held.IsZero() {
+			since = held
+		}
+	}
+
+	age := l.options().clock.Now().Sub(since)
+	if age < 0 {
+		// written in the future as far as we can tell, so it is brand new
+		return 0
+	}
+
+	return age
+}
+
+// staleIn returns how long it takes until the lock recorded as info in the lockfile described by fi
+// becomes stale due to WithStaleAfter and whether it does so at all.
+func (l Lockfile) staleIn(fi os.FileInfo, info LockInfo) (time.Duration, bool) {
+	staleAfter := l.options().staleAfter
+	if staleAfter <= 0 {
+		return 0, false
+	}
+
+	return staleAfter - l.age(fi, info), true
+}
+
+// Refresh keeps the lock we own from becoming stale due to WithStaleAfter
+// by setting the modification time of the lockfile to now.
+// Locks recorded via WithTimestamp keep their age, as it doesn't depend on the modification time.
+// Each Refresh also increases the renewal count kept in a ".renewals" file next to the lockfile, see RenewalCount.
+// A lockfile we don't own anymore, including one recreated with our pid after ours has been removed,
+// is reported as ErrRogueDeletion.
+func (l Lockfile) Refresh() (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if isGloballyDisabled() {
+		return nil
+	}
+
+	if err := l.checkDir(); err != nil {
+		return err
+	}
+
+	if l.st != nil && l.options().emptyContent {
+		if !l.flockHeld() {
+			return ErrRogueDeletion
+		}
+		now := l.options().clock.Now()
+		if err := os.Chtimes(l.name, now, now); err != nil {
+			return err
+		}
+		identify(l.name, l.st)
+		l.renewLease()
+		return nil
+	}
+
+	info, err := l.readInfo()
+	switch {
+	case err == ErrInvalidPid, os.IsNotExist(err):
+		return ErrRogueDeletion
+	case err != nil:
+		return err
+	case !l.isMine(info):
+		return ErrRogueDeletion
+	case l.st != nil && replaced(l.name, l.st):
+		return ErrRogueDeletion
+	}
+
+	if err := l.checkLinks(); err != nil {
+		return err
+	}
+
+	renewals, err := l.RenewalCount()
+	if err != nil {
+		return err
+	}
+
+	now := l.options().clock.Now()
+	if err := os.Chtimes(l.name, now, now); err != nil {
+		return err
+	}
+
+	if err := l.writeRenewals(info.PID, renewals+1); err != nil {
+		return err
+	}
+
+	if l.st != nil {
+		identify(l.name, l.st)
+		if info.Acquired.IsZero() {
+			touch(l.st, now)
+		}
+		l.renewLease()
+	}
+
+	return nil
+}
+
+// RenewalCount returns how often the owner of the lockfile called Refresh since it acquired the lock.
+// A fresh lock starts at zero. The count of a dead owner tells how long that owner held the lock,
+// like a generation number for diagnosing split-brain situations in a leader election built on this package.
+// TryLock passes it as LockInfo.Renewals to WithPreReapHook, right before reaping the lockfile.
+//
+// The count is kept in a ".renewals" file next to the lockfile, which is only valid
+// for the owner and the lockfile it has been written for. Unlock and reaping remove it.
+// Refresh merely changes the modification time of the lockfile, so it never replaces the lockfile of someone else.
+func (l Lockfile) RenewalCount() (uint64, error) {
+	info, err := l.readInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	return l.renewals(info)
+}
+
+// renewals returns the renewal count of the lockfile recorded as info, see RenewalCount.
+func (l Lockfile) renewals(info LockInfo) (uint64, error) {
+	if _, err := os.Lstat(l.name); err != nil {
+		return 0, err
+	}
+
+	content, err := readShared(l.fs(), renewalsName(l.name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	fields := scanFields(content)
+	if fields["pid"] != strconv.Itoa(info.PID) || fields["inode"] != strconv.FormatUint(inodeOf(l.name), 10) {
+		// left by an earlier owner
+		return 0, nil
+	}
+
+	renewals, err := strconv.ParseUint(fields["renewals"], 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+
+	return renewals, nil
+}
+
+// renewalsName returns the name of the file keeping the renewal count for the lockfile name.
+func renewalsName(name string) string {
+	return name + ".renewals"
+}
+
+// writeRenewals atomically records renewals as the renewal count of the lockfile owned by pid.
+func (l Lockfile) writeRenewals(pid int, renewals uint64) error {
+	if _, err := os.Lstat(l.name); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf("pid=%d\ninode=%d\nrenewals=%d\n", pid, inodeOf(l.name), renewals)
+	tmp, cleanup, err := l.makeTempFile(renewalsName(l.name), []byte(content))
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	return l.fs().Rename(tmp, renewalsName(l.name))
+}
+
+// TryLockTTL works like TryLock, but the lock expires after ttl.
+// Once expired, TryLock considers the lock free, even if its owner is still running.
+// This suits cron-like jobs, which might crash without removing their lockfile
+// and whose pid might be reused by another process meanwhile.
+func (l Lockfile) TryLockTTL(expProcName string, ttl time.Duration) error {
+	return l.acquire(expProcName, func() (LockInfo, error) {
+		info := l.newInfo()
+		info.Expires = l.options().clock.Now().Add(ttl)
+		return info, nil
+	})
+}
+
+// TTLRemaining returns how long the lock acquired via TryLockTTL remains valid.
+// It is zero or negative, once the lock has expired.
+// A lock without TTL is reported as ErrNoTTL.
+func (l Lockfile) TTLRemaining() (time.Duration, error) {
+	info, err := l.readInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	if info.Expires.IsZero() {
+		return 0, ErrNoTTL
+	}
+
+	return info.Expires.Sub(l.options().clock.Now()), nil
+}
+
+// expired reports whether the lock recorded as info has outlived its TTL.
+func (l Lockfile) expired(info LockInfo) bool {
+	return !info.Expires.IsZero() && !l.options().clock.Now().Before(info.Expires)
+}
+
+// outlived returns why the lock recorded as info in the lockfile described by fi is stale,
+// although its owner might still be running, or "" if it isn't.
+func (l Lockfile) outlived(fi os.FileInfo, info LockInfo) string {
+	if l.expired(info) {
+		return fmt.Sprintf("expired at %s", info.Expires.Format(time.RFC3339))
+	}
+
+	if remaining, expires := l.staleIn(fi, info); expires && remaining <= 0 {
+		return fmt.Sprintf("older than %v", l.options().staleAfter)
+	}
+
+	if l.rebootedSince(info) {
+		return "written before the last reboot"
+	}
+
+	return ""
+}
+
+// IsStale reports whether TryLock would reap the lockfile and why, without changing anything.
+// It applies the same rules as TryLock, except for comparing the name of the owner,
+// which TryLock is given, and except for WithBusyRecheck.
+// A missing lockfile is not stale.
+func (l Lockfile) IsStale() (stale bool, reason string, err error) {
+	fi, err := os.Stat(l.name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, "not locked", nil
+		}
+		return false, "", err
+	}
+
+	owner, err := l.owner()
+	switch err {
+	case nil:
+	case ErrInvalidPid:
+		return true, "no valid pid recorded", nil
+	case ErrDeadOwner:
+		if l.options().noAutoReap {
+			return false, "owner is dead, but reaping is disabled", nil
+		}
+		return true, "owner is dead", nil
+	default:
+		return false, "", err
+	}
+
+	switch {
+	case l.isMine(owner):
+		return false, "held by this process", nil
+	case l.options().noAutoReap:
+		return false, fmt.Sprintf("held by pid %d and reaping is disabled", owner.PID), nil
+	}
+
+	if reason := l.outlived(fi, owner); reason != "" {
+		return true, reason, nil
+	}
+
+	if l.isForeign(owner) {
+		return false, fmt.Sprintf("held by pid %d on host %s, which cannot be checked", owner.PID, owner.Hostname), nil
+	}
+
+	return false, fmt.Sprintf("held by running pid %d", owner.PID), nil
+}
@@ -0,0 +1,633 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves forward, when waited for.
+// If manual is set, it only moves forward via advance instead, which fires the waits due.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waits  []time.Duration
+	manual bool
+	timers []fakeTimer
+	armed  *sync.Cond // signaled, whenever a manual wait starts
+}
+
+// fakeTimer is a manual wait of fakeClock.
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Now().Truncate(time.Second)}
+	c.armed = sync.NewCond(&c.mu)
+	return c
+}
+
+// newManualClock returns a fakeClock moving forward via advance only.
+func newManualClock() *fakeClock {
+	c := newFakeClock()
+	c.manual = true
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	if c.manual {
+		c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+		c.armed.Broadcast()
+		return ch
+	}
+
+	c.now = c.now.Add(d)
+	ch <- c.now
+	return ch
+}
+
+// advance moves the clock forward by d without recording a wait.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// awaitTimer blocks until a manual wait is pending.
+func (c *fakeClock) awaitTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) == 0 {
+		c.armed.Wait()
+	}
+}
+
+// writeAgedBusyLockfile is writeBusyLockfile with a lockfile written age ago according to clock.
+func writeAgedBusyLockfile(t *testing.T, path string, clock Clock, age time.Duration) string {
+	name := writeBusyLockfile(t, path)
+
+	mtime := clock.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func TestAge(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	writeAgedBusyLockfile(t, path, clock, 42*time.Second)
+	defer os.Remove(path)
+
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lf.Age()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := 42 * time.Second; got != want {
+		t.Fatalf("got age %v, want %v", got, want)
+	}
+}
+
+func TestAgePrefersTimestamp(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock), WithTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	// as if a backup restored the lockfile
+	mtime := clock.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(5 * time.Second)
+
+	got, err := lf.Age()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := 5 * time.Second; got != want {
+		t.Fatalf("got age %v, want %v", got, want)
+	}
+}
+
+func TestStaleAfter(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock), WithStaleAfter(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeAgedBusyLockfile(t, path, clock, 59*time.Second)
+	defer os.Remove(path)
+
+	if got := lf.TryLock(name); got != ErrBusy {
+		t.Fatalf("fresh lockfile: expected error %q, got %v", ErrBusy, got)
+	}
+
+	writeAgedBusyLockfile(t, path, clock, time.Minute)
+
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("stale lockfile: unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForStale(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock), WithStaleAfter(time.Minute), WithWaitForStale())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeAgedBusyLockfile(t, path, clock, 40*time.Second)
+	defer os.Remove(path)
+
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []time.Duration{20 * time.Second}; !reflect.DeepEqual(clock.waits, want) {
+		t.Fatalf("got waits %v, want %v", clock.waits, want)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	clock.advance(time.Minute)
+
+	if err := lf.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if age, err := lf.Age(); err != nil || age != 0 {
+		t.Fatalf("got age %v, %v, want 0, <nil>", age, err)
+	}
+}
+
+func TestRenewalCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 0; round < 2; round++ {
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%d: unexpected error: %v", round, err)
+		}
+
+		acquired, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for want := uint64(0); want < 3; want++ {
+			if got, err := lf.RenewalCount(); err != nil || got != want {
+				t.Fatalf("%d: got renewal count %d, %v, want %d, <nil>", round, got, err, want)
+			}
+
+			if err := lf.Refresh(); err != nil {
+				t.Fatalf("%d: unexpected error: %v", round, err)
+			}
+		}
+
+		if ok, err := lf.LockedByMe(); err != nil || !ok {
+			t.Fatalf("%d: got LockedByMe %v, %v after Refresh, want true, <nil>", round, ok, err)
+		}
+
+		if fi, err := os.Lstat(path); err != nil || !os.SameFile(fi, acquired) {
+			t.Fatalf("%d: Refresh replaced the lockfile", round)
+		}
+
+		// Touching the lockfile otherwise keeps the count.
+		refreshed, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := lf.RenewalCount(); err != nil || got != 3 {
+			t.Fatalf("%d: got renewal count %d, %v after touching, want 3, <nil>", round, got, err)
+		}
+		if err := os.Chtimes(path, refreshed.ModTime(), refreshed.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.Unlock(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", round, err)
+		}
+	}
+}
+
+func TestRecreatedWithSamePID(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	defer release(path, lf.st)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the old file around, so the new one cannot reuse its inode.
+	keep := path + ".old"
+	if err := os.Rename(path, keep); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keep)
+
+	if err := ioutil.WriteFile(path, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inode(fi) == 0 {
+		t.Skip("no inode numbers on this platform")
+	}
+
+	if err := lf.Refresh(); err != ErrRogueDeletion {
+		t.Errorf("Refresh: expected error %q, got %v", ErrRogueDeletion, err)
+	}
+
+	if err := lf.Unlock(); err != ErrRogueDeletion {
+		t.Errorf("Unlock: expected error %q, got %v", ErrRogueDeletion, err)
+	}
+}
+
+func TestTryLockTTL(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLockTTL("main", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := lf.readInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Minute); !info.Expires.Equal(want) {
+		t.Fatalf("got expiry %v, want %v", info.Expires, want)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// as written by a live owner calling TryLockTTL
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	info, err = lf.readInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Expires = clock.Now().Add(time.Minute)
+	content, err := pidCodec{}.Encode(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock(name); err != ErrBusy {
+		t.Fatalf("fresh: expected error %q, got %v", ErrBusy, err)
+	}
+
+	clock.advance(time.Minute - time.Nanosecond)
+	if err := lf.TryLock(name); err != ErrBusy {
+		t.Fatalf("before expiry: expected error %q, got %v", ErrBusy, err)
+	}
+
+	clock.advance(time.Nanosecond)
+	if err := lf.TryLock(name); err != nil {
+		t.Fatalf("expired: unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	path, err := filepath.Abs("test_stale.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	clock := newFakeClock()
+	dead, live := GetDeadPID(), os.Getppid()
+	expires := clock.Now().Format(time.RFC3339Nano)
+
+	tests := [...]struct {
+		content string // no lockfile, if empty
+		age     time.Duration
+		opts    []Option
+		stale   bool
+		reason  string
+	}{
+		{reason: "not locked"},
+		{content: "junk\n", stale: true, reason: "no valid pid recorded"},
+		{content: fmt.Sprintf("%d\n", dead), stale: true, reason: "owner is dead"},
+		{
+			content: fmt.Sprintf("%d\n", dead),
+			opts:    []Option{WithNoAutoReap()},
+			reason:  "owner is dead, but reaping is disabled",
+		},
+		{content: fmt.Sprintf("%d\n", os.Getpid()), reason: "held by this process"},
+		{content: fmt.Sprintf("%d\n", live), reason: fmt.Sprintf("held by running pid %d", live)},
+		{
+			content: fmt.Sprintf("%d\n", live),
+			age:     2 * time.Minute,
+			opts:    []Option{WithStaleAfter(time.Minute)},
+			stale:   true,
+			reason:  "older than 1m0s",
+		},
+		{
+			content: fmt.Sprintf("%d\nexpires=%s\n", live, expires),
+			stale:   true,
+			reason:  "expired at " + clock.Now().Format(time.RFC3339),
+		},
+		{
+			content: fmt.Sprintf("%d\nhost=other\n", live),
+			opts:    []Option{WithHostname("here")},
+			reason:  fmt.Sprintf("held by pid %d on host other, which cannot be checked", live),
+		},
+	}
+
+	for step, tc := range tests {
+		os.Remove(path)
+		if tc.content != "" {
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+			mtime := clock.Now().Add(-tc.age)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		lf, err := New(path, append([]Option{WithClock(clock)}, tc.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stale, reason, err := lf.IsStale()
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+		if stale != tc.stale || reason != tc.reason {
+			t.Errorf("%d: got %v, %q, want %v, %q", step, stale, reason, tc.stale, tc.reason)
+		}
+	}
+}
+
+func TestAgeOfOwnLockIgnoresClockSteps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithStaleAfter(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	// The wall clock was two hours behind, when we wrote the lockfile, and has been stepped forward since.
+	written := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, written, written); err != nil {
+		t.Fatal(err)
+	}
+
+	age, err := lf.Age()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age >= time.Minute {
+		t.Fatalf("got age %v of our own lock, want less than a minute", age)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := lf.outlived(fi, LockInfo{PID: os.Getpid()}); reason != "" {
+		t.Fatalf("our own lock is stale: %s", reason)
+	}
+
+	// Others can only go by the wall clock.
+	other, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age, err := other.Age(); err != nil || age < time.Hour {
+		t.Fatalf("got age %v, %v as seen by others, want at least an hour", age, err)
+	}
+}
+
+func TestTTLRemaining(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lf.TTLRemaining(); !os.IsNotExist(err) {
+		t.Fatalf("not locked: expected a missing lockfile, got %v", err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.TTLRemaining(); err != ErrNoTTL {
+		t.Fatalf("without TTL: expected error %q, got %v", ErrNoTTL, err)
+	}
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLockTTL("main", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	tests := [...]struct {
+		advance   time.Duration
+		remaining time.Duration
+	}{
+		{advance: 30 * time.Second, remaining: 30 * time.Second},
+		{advance: 30 * time.Second, remaining: 0},
+		{advance: 15 * time.Second, remaining: -15 * time.Second},
+	}
+
+	for step, tc := range tests {
+		clock.advance(tc.advance)
+
+		remaining, err := lf.TTLRemaining()
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+		if remaining != tc.remaining {
+			t.Errorf("%d: expected %v remaining, got %v", step, tc.remaining, remaining)
+		}
+	}
+}
+
+func TestRenewalCountOfDeadOwner(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lck")
+
+	// The leader refreshed its lock three times before dying.
+	deadPID := GetDeadPID()
+	writeLockfiles(t, dir, map[string]string{"test.lck": fmt.Sprintln(deadPID)})
+	leader, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.writeRenewals(deadPID, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	var reaped []LockInfo
+	waiter, err := New(path, WithPreReapHook(func(owner LockInfo) error {
+		reaped = append(reaped, owner)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := waiter.RenewalCount(); err != nil || got != 3 {
+		t.Fatalf("got renewal count %d, %v of the dead leader, want 3, <nil>", got, err)
+	}
+
+	if err := waiter.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer waiter.Unlock()
+
+	if want := []LockInfo{{PID: deadPID, Renewals: 3}}; !reflect.DeepEqual(reaped, want) {
+		t.Fatalf("pre-reap hook got %+v, want %+v", reaped, want)
+	}
+
+	if _, err := os.Stat(renewalsName(path)); !os.IsNotExist(err) {
+		t.Fatalf("expected the renewal count of the dead leader to be reaped, got %v", err)
+	}
+	if got, err := waiter.RenewalCount(); err != nil || got != 0 {
+		t.Fatalf("got renewal count %d, %v of the new leader, want 0, <nil>", got, err)
+	}
+}
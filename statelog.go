@@ -0,0 +1,261 @@
+package lockfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WithStateLog appends a line to the file path each time the lock is acquired or released by this Lockfile,
+// recording the pid and inode of the lockfile, so RecoverFromLog can take the locks held back after a crash.
+// Rewriting the lockfile held, e.g. via Canonicalize, is recorded as acquiring it anew, as its inode changes.
+// Lockfiles using the same path share it. Each line is written by a single write(2) and synced,
+// so a crash loses at most the line being written, and replaying it again and again yields the same.
+// Failing to write the log doesn't affect locking, but is reported to the logger given by WithLogger.
+func WithStateLog(path string) Option {
+	return func(o *options) {
+		o.stateLogPath = path
+	}
+}
+
+// Events of the state log, see WithStateLog.
+const (
+	stateAcquire = "acquire"
+	stateRelease = "release"
+)
+
+// stateEntry is a line of the state log.
+type stateEntry struct {
+	event string
+	pid   int
+	inode uint64
+	path  string // absolute path of the lockfile, last on the line, as it may contain spaces
+}
+
+func (e stateEntry) String() string {
+	return fmt.Sprintf("%s %d %d %s\n", e.event, e.pid, e.inode, e.path)
+}
+
+// parseStateEntry parses a line of the state log. A torn or foreign line is reported as not ok.
+func parseStateEntry(line string) (e stateEntry, ok bool) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 || (fields[0] != stateAcquire && fields[0] != stateRelease) || !filepath.IsAbs(fields[3]) {
+		return stateEntry{}, false
+	}
+
+	pid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return stateEntry{}, false
+	}
+	inode, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return stateEntry{}, false
+	}
+
+	return stateEntry{event: fields[0], pid: pid, inode: inode, path: fields[3]}, true
+}
+
+// logState appends event to the state log, if WithStateLog has been given.
+func (l Lockfile) logState(event string) {
+	path := l.options().stateLogPath
+	if path == "" {
+		return
+	}
+
+	e := stateEntry{event: stateRelease, pid: l.options().pid, path: l.name}
+	if event == "acquired" {
+		e.event = stateAcquire
+		e.inode = inodeOf(l.name)
+	}
+
+	if err := appendStateLog(path, e.String()); err != nil {
+		l.warnf("lockfile: cannot write state log %s: %v", path, err)
+	}
+}
+
+// appendStateLog appends line to the state log path and syncs it.
+func appendStateLog(path, line string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// readStateLog returns the last acquisition logged for each lockfile not released afterwards, sorted by path.
+func readStateLog(path string) ([]stateEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	held := map[string]stateEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e, ok := parseStateEntry(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		if e.event == stateAcquire {
+			held[e.path] = e
+		} else if prev, ok := held[e.path]; ok && prev.pid == e.pid {
+			delete(held, e.path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]stateEntry, 0, len(held))
+	for _, e := range held {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	return entries, nil
+}
+
+// RecoverFromLog takes back the locks the state log path, as written via WithStateLog, records as held,
+// e.g. by this supervisor before it crashed and restarted.
+// A lock is only taken back, if its lockfile is still the one logged, i.e. has the same inode
+// and names the same owner, which must be this process or not be running anymore.
+// Its lockfile is rewritten to name this process then.
+// A lockfile, which has been rewritten since, but still names the logged owner not running anymore, is removed.
+// Lockfiles of owners not running anymore are only taken back or removed like TryLock reaps them,
+// so they are left alone with WithNoAutoReap or if the hook given by WithPreReapHook vetoes.
+// The others are left alone, and their release is logged, so the log records only the locks taken back.
+// The log is only appended to, so other Lockfiles may keep writing to it meanwhile.
+//
+// The Lockfiles returned are made by New with opts and keep writing to the state log.
+func RecoverFromLog(path string, opts ...Option) ([]Lockfile, error) {
+	entries, err := readStateLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts[:len(opts):len(opts)], WithStateLog(path))
+
+	var recovered []Lockfile
+	for _, e := range entries {
+		l, err := New(e.path, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := l.recover(e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			recovered = append(recovered, l)
+		}
+	}
+
+	if err := logUnrecovered(path, entries, recovered); err != nil {
+		return nil, err
+	}
+
+	return recovered, nil
+}
+
+// recover takes back the lock logged by e, if its lockfile is still the one logged,
+// or removes it, if it is stale, see RecoverFromLog.
+func (l Lockfile) recover(e stateEntry) (bool, error) {
+	inspected, err := os.Lstat(l.name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	logged := e.inode != 0 && inodeOf(l.name) == e.inode
+
+	info, err := l.readInfo()
+	switch {
+	case err == ErrInvalidPid, os.IsNotExist(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	case info.PID != e.pid:
+		return false, nil
+	}
+
+	if !l.isMine(info) {
+		if l.isForeign(info) {
+			return false, nil
+		}
+
+		running, err := l.isRunning(info.PID)
+		if err != nil {
+			return false, err
+		}
+		if running || l.options().noAutoReap {
+			return false, nil
+		}
+
+		if err := l.preReap(info); err != nil {
+			l.warnf("lockfile: not recovering %s: %v", l.name, err)
+			return false, nil
+		}
+
+		if !logged {
+			_, err := l.removeStale(inspected)
+			return false, err
+		}
+
+		if err := l.replace(l.newInfo(), inspected); err != nil {
+			if err == ErrBusy {
+				// changed meanwhile
+				return false, nil
+			}
+			return false, err
+		}
+	} else if !logged {
+		return false, nil
+	}
+
+	hold(l.name, l.st)
+	touch(l.st, l.options().clock.Now())
+	l.recordDir()
+	return true, nil
+}
+
+// logUnrecovered appends the release of each lock logged as entries, which isn't held as recovered, to the state log path.
+func logUnrecovered(path string, entries []stateEntry, recovered []Lockfile) error {
+	held := make(map[string]bool, len(recovered))
+	for _, l := range recovered {
+		held[l.name] = true
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		if !held[e.path] {
+			b.WriteString(stateEntry{event: stateRelease, pid: e.pid, path: e.path}.String())
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	return appendStateLog(path, b.String())
+}
@@ -0,0 +1,193 @@
+package lockfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRecoverFromLog(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "state.log")
+
+	// The supervisor before the crash had another pid, which is gone now.
+	deadPID := GetDeadPID()
+	before := []Option{
+		WithStateLog(logPath),
+		WithPIDResolver(func() (int, error) { return deadPID, nil }),
+		WithLivenessChecker(func(pid int) (bool, error) { return true, nil }),
+	}
+
+	locks := map[string]Lockfile{}
+	for _, name := range []string{"held", "refreshed", "canonical", "released", "taken", "removed", "rewritten"} {
+		lf, err := New(filepath.Join(dir, name+".lck"), before...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		locks[name] = lf
+	}
+
+	if err := locks["refreshed"].Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := locks["canonical"].Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := locks["released"].Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Rewritten by someone else, but still naming the dead supervisor, so it is stale.
+	rewritten := locks["rewritten"].name
+	if err := ioutil.WriteFile(rewritten+".new", []byte(strconv.Itoa(deadPID)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(rewritten+".new", rewritten); err != nil {
+		t.Fatal(err)
+	}
+	// Someone else took over after the crash.
+	writeBusyLockfile(t, locks["taken"].name)
+	if err := os.Remove(locks["removed"].name); err != nil {
+		t.Fatal(err)
+	}
+	for _, lf := range locks {
+		_ = lf.Close()
+	}
+
+	for i := 0; i < 2; i++ {
+		before, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recovered, err := RecoverFromLog(logPath)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		var names []string
+		for _, lf := range recovered {
+			names = append(names, filepath.Base(lf.name))
+			if ok, err := lf.LockedByMe(); err != nil || !ok {
+				t.Fatalf("%d: got LockedByMe %v, %v for %s, want true, <nil>", i, ok, err, lf.name)
+			}
+		}
+		if want := []string{"canonical.lck", "held.lck", "refreshed.lck"}; !reflect.DeepEqual(names, want) {
+			t.Fatalf("%d: got %v, want %v", i, names, want)
+		}
+		if _, err := os.Lstat(rewritten); !os.IsNotExist(err) {
+			t.Fatalf("%d: stale %s not removed: %v", i, rewritten, err)
+		}
+
+		// Only appended to, so nothing others write meanwhile gets lost.
+		content, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(content), string(before)) {
+			t.Fatalf("%d: got log %q, want it to start with %q", i, content, before)
+		}
+
+		held, err := readStateLog(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(held) != len(recovered) {
+			t.Fatalf("%d: got log %q, want %d locks held", i, content, len(recovered))
+		}
+		for _, e := range held {
+			if e.pid != os.Getpid() {
+				t.Fatalf("%d: got log %q, want locks held by %d", i, content, os.Getpid())
+			}
+		}
+	}
+
+	// Recovered locks keep writing to the log.
+	recovered, err := RecoverFromLog(logPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, lf := range recovered {
+		if err := lf.Unlock(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if recovered, err := RecoverFromLog(logPath); err != nil || len(recovered) != 0 {
+		t.Fatalf("got %v, %v after Unlock, want none", recovered, err)
+	}
+	if _, err := os.Stat(locks["taken"].name); err != nil {
+		t.Fatalf("lockfile of someone else has been touched: %v", err)
+	}
+}
+
+func TestRecoverFromLogReaping(t *testing.T) {
+	deadPID := GetDeadPID()
+
+	var reaped []int
+	veto := WithPreReapHook(func(owner LockInfo) error {
+		reaped = append(reaped, owner.PID)
+		return errors.New("fenced off elsewhere")
+	})
+
+	// The lockfile of the dead supervisor is left alone, as it may not be reaped.
+	for step, opt := range []Option{WithNoAutoReap(), veto} {
+		dir := t.TempDir()
+		logPath := filepath.Join(dir, "state.log")
+
+		lf, err := New(filepath.Join(dir, "test.lck"),
+			WithStateLog(logPath),
+			WithPIDResolver(func() (int, error) { return deadPID, nil }),
+			WithLivenessChecker(func(pid int) (bool, error) { return true, nil }),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lf.TryLock("main"); err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+		_ = lf.Close()
+
+		if recovered, err := RecoverFromLog(logPath, opt); err != nil || len(recovered) != 0 {
+			t.Fatalf("%d: got %v, %v, want none", step, recovered, err)
+		}
+		if info, err := lf.readInfo(); err != nil || info.PID != deadPID {
+			t.Fatalf("%d: got owner %v, %v, want %d", step, info.PID, err, deadPID)
+		}
+	}
+
+	if want := []int{deadPID}; !reflect.DeepEqual(reaped, want) {
+		t.Fatalf("pre-reap hook got %v, want %v", reaped, want)
+	}
+}
+
+func TestParseStateEntry(t *testing.T) {
+	tests := [...]struct {
+		line string
+		ok   bool
+	}{
+		{line: "acquire 42 7 /run/my lock.lck", ok: true},
+		{line: "release 42 0 /run/test.lck", ok: true},
+		{line: "acquire 42 7"},
+		{line: "acquire 42 7 relative.lck"},
+		{line: "acquire x 7 /run/test.lck"},
+		{line: "steal 42 7 /run/test.lck"},
+	}
+
+	for step, tc := range tests {
+		e, ok := parseStateEntry(tc.line)
+		if ok != tc.ok {
+			t.Errorf("%d: got ok %v, want %v", step, ok, tc.ok)
+		}
+		if ok && e.String() != tc.line+"\n" {
+			t.Errorf("%d: got %q back, want %q", step, e.String(), tc.line+"\n")
+		}
+	}
+}
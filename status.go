@@ -0,0 +1,184 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shirou/gopsutil/v4/process"
+	"os"
+	"strings"
+	"time"
+)
+
+// LockStatus describes the state of a lockfile and its owner.
+type LockStatus struct {
+	Path  string        // path name of the lockfile
+	PID   int           // pid of the owner, 0 if there is no valid lockfile
+	Alive bool          // whether the owner is running, which is assumed for owners on other hosts
+	Name  string        // process name of the owner, if known
+	Host  string        // host of the owner, if recorded
+	Age   time.Duration // time since the lockfile has been written
+	Token uint64        // fencing token, 0 if none
+
+	Corrupt bool   // whether the lockfile cannot be parsed, so its owner is unknown
+	Raw     string // first line of a Corrupt lockfile as read, where the pid should have been
+}
+
+// Status returns the state of the lockfile without changing it.
+// A missing lockfile is reported with a zero PID and no error.
+// An invalid one is reported the same way, but marked as Corrupt and together with ErrInvalidPid.
+func (l Lockfile) Status() (LockStatus, error) {
+	status := LockStatus{Path: l.name}
+
+	fi, err := os.Stat(l.name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status, nil
+		}
+		return status, err
+	}
+	status.Age = l.age(fi, LockInfo{})
+
+	info, err := l.readInfo()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return LockStatus{Path: l.name}, nil
+		}
+		status.Corrupt = err == ErrInvalidPid || err == ErrOversizeLockfile
+		if content, rerr := l.readLockfile(); err == ErrInvalidPid && rerr == nil {
+			_, status.Raw, _ = scanPidLineVerbose(content)
+		}
+		return status, err
+	}
+	status.Age = l.age(fi, info)
+	status.PID = info.PID
+	status.Token = info.Token
+	status.Host = info.Hostname
+
+	if l.isForeign(info) {
+		status.Alive = true
+		return status, nil
+	}
+
+	if status.Alive, err = l.isRunning(info.PID); err != nil {
+		return status, err
+	}
+
+	// The name is nice to have, but might be hidden from us.
+	if status.Alive {
+		if proc, err := process.NewProcess(int32(info.PID)); err == nil {
+			status.Name, _ = proc.Name()
+		}
+	}
+
+	return status, nil
+}
+
+// TryLockOrStatus works like TryLock, but also returns the Status of the lockfile.
+// On success, it describes us as the owner, on ErrBusy the owner keeping us from the lock.
+// The owner might have released the lock in between though, so the status is a hint only.
+// On other errors, the status only tells the path of the lockfile.
+func (l Lockfile) TryLockOrStatus(expProcName string) (LockStatus, error) {
+	err := l.TryLock(expProcName)
+	if err != nil && !errors.Is(err, ErrBusy) {
+		return LockStatus{Path: l.name}, err
+	}
+
+	status, serr := l.Status()
+	if err == nil && serr != nil {
+		return status, serr
+	}
+
+	return status, err
+}
+
+// OwnerUsername returns the name of the user running the owner of the lockfile.
+// This is meant for diagnostics only.
+// An owner not running anymore is reported as ErrDeadOwner.
+// As the users of other hosts are unknown here, owners on other hosts are reported as an error.
+func (l Lockfile) OwnerUsername() (string, error) {
+	info, err := l.owner()
+	if err != nil {
+		return "", err
+	}
+
+	if l.isForeign(info) {
+		return "", fmt.Errorf("cannot tell user of pid %d on host %s", info.PID, info.Hostname)
+	}
+
+	proc, err := process.NewProcess(int32(info.PID))
+	if err != nil {
+		return "", fmt.Errorf("cannot tell user of pid %d: %w", info.PID, err)
+	}
+
+	username, err := proc.Username()
+	if err != nil {
+		return "", fmt.Errorf("cannot tell user of pid %d: %w", info.PID, err)
+	}
+
+	return username, nil
+}
+
+// String describes the status for humans.
+func (s LockStatus) String() string {
+	if s.Corrupt && s.Raw != "" {
+		return fmt.Sprintf("%s: corrupt, first line %q", s.Path, s.Raw)
+	}
+	if s.Corrupt {
+		return fmt.Sprintf("%s: corrupt", s.Path)
+	}
+	if s.PID == 0 {
+		return fmt.Sprintf("%s: not locked", s.Path)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: locked by pid %d", s.Path, s.PID)
+	if s.Name != "" {
+		fmt.Fprintf(&b, " (%s)", s.Name)
+	}
+	if s.Host != "" {
+		fmt.Fprintf(&b, " on host %s", s.Host)
+	}
+	if !s.Alive {
+		b.WriteString(", which is dead")
+	}
+	fmt.Fprintf(&b, ", age %v", s.Age)
+	if s.Token != 0 {
+		fmt.Fprintf(&b, ", fencing token %d", s.Token)
+	}
+
+	return b.String()
+}
+
+// MarshalText implements encoding.TextMarshaler using String.
+func (s LockStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// lockStatusJSON is the stable JSON representation of LockStatus.
+type lockStatusJSON struct {
+	Path       string  `json:"path"`
+	PID        int     `json:"pid"`
+	Alive      bool    `json:"alive"`
+	Name       string  `json:"name"`
+	Host       string  `json:"host"`
+	AgeSeconds float64 `json:"age_seconds"`
+	Token      uint64  `json:"fencing_token"`
+	Corrupt    bool    `json:"corrupt"`
+	Raw        string  `json:"raw"`
+}
+
+// MarshalJSON implements json.Marshaler with stable snake_case keys.
+func (s LockStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lockStatusJSON{
+		Path:       s.Path,
+		PID:        s.PID,
+		Alive:      s.Alive,
+		Name:       s.Name,
+		Host:       s.Host,
+		AgeSeconds: s.Age.Seconds(),
+		Token:      s.Token,
+		Corrupt:    s.Corrupt,
+		Raw:        s.Raw,
+	})
+}
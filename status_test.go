@@ -0,0 +1,221 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	path, err := filepath.Abs("test_status.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lf.Status()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (LockStatus{Path: path}); got != want {
+		t.Fatalf("free lockfile: got %+v, want %+v", got, want)
+	}
+
+	name := writeAgedBusyLockfile(t, path, clock, 3*time.Second)
+	defer os.Remove(path)
+
+	got, err = lf.Status()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := LockStatus{Path: path, PID: os.Getppid(), Alive: true, Name: name, Age: 3 * time.Second}
+	if got != want {
+		t.Fatalf("busy lockfile: got %+v, want %+v", got, want)
+	}
+}
+
+func TestStatusCorrupt(t *testing.T) {
+	path, err := filepath.Abs("test_status.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("4\xff2\npid=42\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	got, err := lf.Status()
+	if err != ErrInvalidPid {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidPid)
+	}
+	if !got.Corrupt || got.Raw != "4\xff2" {
+		t.Fatalf("got %+v, want the corrupt first line", got)
+	}
+}
+
+func TestTryLockOrStatus(t *testing.T) {
+	path, err := filepath.Abs("test_status.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lf.TryLockOrStatus("main")
+	if err != nil {
+		t.Fatalf("free: unexpected error: %v", err)
+	}
+	if got.PID != os.Getpid() || !got.Alive {
+		t.Fatalf("free: got %+v, want us as live owner", got)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeAgedBusyLockfile(t, path, clock, 3*time.Second)
+	defer os.Remove(path)
+
+	got, err = lf.TryLockOrStatus(name)
+	if err != ErrBusy {
+		t.Fatalf("busy: expected error %q, got %v", ErrBusy, err)
+	}
+	want := LockStatus{Path: path, PID: os.Getppid(), Alive: true, Name: name, Age: 3 * time.Second}
+	if got != want {
+		t.Fatalf("busy: got %+v, want %+v", got, want)
+	}
+}
+
+func TestOwnerUsername(t *testing.T) {
+	path, err := filepath.Abs("test_status.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	me, err := user.Current()
+	if err != nil {
+		t.Skipf("cannot tell current user: %v", err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lf.OwnerUsername()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != me.Username {
+		t.Errorf("got user %q, want %q", got, me.Username)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", GetDeadPID())), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if _, err := lf.OwnerUsername(); err != ErrDeadOwner {
+		t.Fatalf("dead owner: expected error %q, got %v", ErrDeadOwner, err)
+	}
+}
+
+func TestLockStatusJSON(t *testing.T) {
+	status := LockStatus{
+		Path:  "/run/test.pid",
+		PID:   42,
+		Alive: true,
+		Name:  "main",
+		Host:  "db1",
+		Age:   1500 * time.Millisecond,
+		Token: 7,
+	}
+
+	content, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"path":          "/run/test.pid",
+		"pid":           42.0,
+		"alive":         true,
+		"name":          "main",
+		"host":          "db1",
+		"age_seconds":   1.5,
+		"fencing_token": 7.0,
+		"corrupt":       false,
+		"raw":           "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %s, want %v", content, want)
+	}
+}
+
+func TestLockStatusString(t *testing.T) {
+	tests := [...]struct {
+		status LockStatus
+		want   string
+	}{
+		{
+			status: LockStatus{Path: "/run/test.pid"},
+			want:   "/run/test.pid: not locked",
+		},
+		{
+			status: LockStatus{Path: "/run/test.pid", PID: 42, Alive: true, Name: "main", Age: time.Second, Token: 7},
+			want:   "/run/test.pid: locked by pid 42 (main), age 1s, fencing token 7",
+		},
+		{
+			status: LockStatus{Path: "/run/test.pid", PID: 42, Age: time.Minute},
+			want:   "/run/test.pid: locked by pid 42, which is dead, age 1m0s",
+		},
+		{
+			status: LockStatus{Path: "/run/test.pid", PID: 42, Alive: true, Host: "db1", Age: time.Second},
+			want:   "/run/test.pid: locked by pid 42 on host db1, age 1s",
+		},
+		{
+			status: LockStatus{Path: "/run/test.pid", Corrupt: true, Raw: "12\x0034"},
+			want:   `/run/test.pid: corrupt, first line "12\x0034"`,
+		},
+	}
+
+	for step, tc := range tests {
+		if got := tc.status.String(); got != tc.want {
+			t.Errorf("%d: got %q, want %q", step, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package lockfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stressPathEnv tells TestStressHelperProcess which lockfile to contend for.
+const stressPathEnv = "LOCKFILE_STRESS_PATH"
+
+// TestStressHelperProcess is a contender of TestStressExactlyOneWinner.
+// It tries the lock on "go" from stdin, reports the outcome and holds on to the lock until stdin is closed.
+func TestStressHelperProcess(t *testing.T) {
+	path := os.Getenv(stressPathEnv)
+	if path == "" {
+		return
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	if _, err := stdin.ReadString('\n'); err != nil {
+		os.Exit(1)
+	}
+
+	switch err := lf.TryLock(filepath.Base(os.Args[0])); err {
+	case nil:
+		fmt.Println("locked")
+		_, _ = io.Copy(ioutil.Discard, stdin)
+		if err := lf.Unlock(); err != nil {
+			os.Exit(1)
+		}
+	case ErrBusy:
+		fmt.Println("busy")
+	default:
+		fmt.Println(err)
+	}
+
+	os.Exit(0)
+}
+
+func TestStressExactlyOneWinner(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+
+	path, err := filepath.Abs("test_stress.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	const contenders = 16
+
+	type contender struct {
+		cmd    *exec.Cmd
+		stdin  io.WriteCloser
+		stdout *bufio.Reader
+	}
+
+	cs := make([]contender, 0, contenders)
+	defer func() {
+		for _, c := range cs {
+			c.stdin.Close()
+			_ = c.cmd.Wait()
+		}
+	}()
+
+	for i := 0; i < contenders; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStressHelperProcess$")
+		cmd.Env = append(os.Environ(), stressPathEnv+"="+path)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cs = append(cs, contender{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)})
+	}
+
+	// start the race as close together as we can
+	for _, c := range cs {
+		if _, err := io.WriteString(c.stdin, "go\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	winners := 0
+	for i, c := range cs {
+		line, err := c.stdout.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%d: cannot read outcome: %v", i, err)
+		}
+
+		switch outcome := strings.TrimSpace(line); outcome {
+		case "locked":
+			winners++
+		case "busy":
+		default:
+			t.Errorf("%d: unexpected outcome %q", i, outcome)
+		}
+	}
+
+	if winners != 1 {
+		t.Fatalf("got %d winners, want exactly one", winners)
+	}
+}
@@ -0,0 +1,81 @@
+package lockfile
+
+import (
+	"github.com/shirou/gopsutil/v4/process"
+	"os"
+)
+
+// UnlockToken proves the ownership of a lock acquired by Acquire.
+// It records the pid and start time of the owner and the inode of the lockfile at that moment.
+type UnlockToken struct {
+	pid     int
+	started int64  // start time of the owner in ms since the epoch, 0 if unknown
+	ino     uint64 // 0 if unknown
+}
+
+// Acquire works like TryLock, but also returns the token UnlockWith needs to release the lock.
+func (l Lockfile) Acquire(expProcName string) (UnlockToken, error) {
+	if err := l.TryLock(expProcName); err != nil {
+		return UnlockToken{}, err
+	}
+
+	pid := l.options().pid
+	return UnlockToken{pid: pid, started: startTime(pid), ino: inodeOf(l.name)}, nil
+}
+
+// UnlockWith works like Unlock, but only releases the lock acquired with tok.
+// If the lockfile is not the one acquired with tok anymore, ErrRogueDeletion is returned,
+// even if it names this process as its owner. This happens, if a second Lockfile for the same path
+// in this process acquired it meanwhile.
+func (l Lockfile) UnlockWith(tok UnlockToken) error {
+	if !isGloballyDisabled() {
+		if err := l.checkToken(tok); err != nil {
+			return l.wrapErr(err)
+		}
+	}
+
+	return l.unlock(nil)
+}
+
+// checkToken returns ErrRogueDeletion, if the lockfile is not the one acquired with tok anymore.
+// The lockfile of WithEmptyContent doesn't name its owner, so only its inode is checked then.
+func (l Lockfile) checkToken(tok UnlockToken) error {
+	if !l.options().emptyContent {
+		info, err := l.readInfo()
+		switch {
+		case err == ErrInvalidPid, os.IsNotExist(err):
+			return ErrRogueDeletion
+		case err != nil:
+			return err
+		case info.PID != tok.pid || l.isForeign(info):
+			return ErrRogueDeletion
+		}
+	} else if tok.pid != l.options().pid {
+		return ErrRogueDeletion
+	}
+
+	if ino := inodeOf(l.name); tok.ino != 0 && ino != 0 && ino != tok.ino {
+		return ErrRogueDeletion
+	}
+
+	if started := startTime(tok.pid); tok.started != 0 && started != 0 && started != tok.started {
+		return ErrRogueDeletion
+	}
+
+	return nil
+}
+
+// startTime returns when the process pid started in ms since the epoch or 0, if that is unknown.
+func startTime(pid int) int64 {
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return 0
+	}
+
+	started, err := proc.CreateTime()
+	if err != nil {
+		return 0
+	}
+
+	return started
+}
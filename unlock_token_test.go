@@ -0,0 +1,104 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnlockWith(t *testing.T) {
+	path, err := filepath.Abs("test_unlock_token.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := lf.Acquire("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.UnlockWith(tok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.UnlockWith(tok); err != ErrRogueDeletion {
+		t.Fatalf("released: expected error %q, got %v", ErrRogueDeletion, err)
+	}
+}
+
+func TestUnlockWithMismatchedToken(t *testing.T) {
+	path, err := filepath.Abs("test_unlock_token.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := first.Acquire("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inode(fi) == 0 {
+		t.Skip("no inode numbers on this platform")
+	}
+
+	// Keep the old lockfile around, so the new one cannot reuse its inode.
+	keep := path + ".old"
+	if err := os.Link(path, keep); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keep)
+
+	// Same process, same path: The second Lockfile replaces the lockfile of the first one.
+	secondTok, err := second.Acquire("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.UnlockWith(tok); err != ErrRogueDeletion {
+		t.Fatalf("expected error %q, got %v", ErrRogueDeletion, err)
+	}
+
+	if err := second.UnlockWith(secondTok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUnlockWithDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetGloballyDisabled(true)
+	defer SetGloballyDisabled(false)
+
+	tok, err := lf.Acquire("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.UnlockWith(tok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
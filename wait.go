@@ -0,0 +1,160 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// Default backoff between attempts of Lock.
+const (
+	minRetryDelay = 10 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// Lock blocks until it owns the lock or ctx is done.
+// Temporary errors like ErrBusy are retried with exponential backoff, see WithBackoff,
+// all other errors are returned right away. See WithRetryable to retry others.
+// If ctx is done first, the error of ctx is returned.
+// Waiting longer than allowed by WithWatchdogDeadline returns context.DeadlineExceeded.
+// With WithFairQueue, waiters get the lock in the order they called Lock.
+func (l Lockfile) Lock(ctx context.Context, expProcName string) (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	if isGloballyDisabled() {
+		return nil
+	}
+
+	start := l.options().clock.Now()
+
+	tryLock := l.TryLock
+	if l.options().fairQueue {
+		seq, err := l.enqueue()
+		if err != nil {
+			return err
+		}
+		defer l.dequeue(seq)
+
+		tryLock = func(expProcName string) error {
+			return l.tryLockQueued(seq, expProcName)
+		}
+	}
+
+	return l.retry(ctx, start, func() error { return tryLock(expProcName) })
+}
+
+// retry calls try until it succeeds, with the backoff, retryable errors, clock and watchdog deadline
+// of the options of l, and reports the wait since start to the Metrics given by WithMetrics.
+func (l Lockfile) retry(ctx context.Context, start time.Time, try func() error) error {
+	clock := l.options().clock
+
+	var deadline time.Time
+	if timeout := l.options().lockTimeout; timeout > 0 {
+		deadline = clock.Now().Add(timeout)
+	}
+
+	retryable := l.options().retryable
+	backoff := l.options().backoff
+	backoff.Reset()
+	for attempt := 0; ; attempt++ {
+		err := try()
+		if err == nil {
+			l.observeWait(start)
+			return nil
+		}
+		if !retryable(err) {
+			return err
+		}
+
+		wait := backoff.Next(attempt)
+		if !deadline.IsZero() {
+			remaining := deadline.Sub(clock.Now())
+			if remaining <= 0 {
+				return context.DeadlineExceeded
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(wait):
+		}
+	}
+}
+
+// AcquireWithin blocks until it owns the lock like Lock does, but at most for budget.
+// Meanwhile stale lockfiles are reaped like TryLock does.
+// If a live owner still holds the lock once the budget is exhausted, ErrBusy is returned.
+// If ctx is done first, the error of ctx is returned, and other errors right away.
+func (l Lockfile) AcquireWithin(ctx context.Context, procName string, budget time.Duration) error {
+	bounded, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	err := l.Lock(bounded, procName)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return l.wrapErr(ErrBusy)
+	}
+
+	return err
+}
+
+// LockBlocking works like Lock, but waits for the lockfile to be removed or replaced instead of polling,
+// so it acquires a released lock right away and uses less CPU meanwhile.
+// As an owner exiting without releasing its lock doesn't change the lockfile,
+// it still tries again after the longest backoff of Lock.
+// Where the lockfile cannot be watched, it polls like Lock.
+func (l Lockfile) LockBlocking(ctx context.Context, expProcName string) (err error) {
+	defer func() { err = l.wrapErr(err) }()
+
+	start := l.options().clock.Now()
+	w, err := newWatcher(filepath.Dir(l.name), filepath.Base(l.name))
+	if err != nil {
+		return l.Lock(ctx, expProcName)
+	}
+	defer w.Close()
+
+	for {
+		err = l.TryLock(expProcName)
+		if err == nil {
+			l.observeWait(start)
+			return nil
+		}
+		if !l.options().retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.changed:
+		case <-l.options().clock.After(maxRetryDelay):
+		}
+	}
+}
+
+// LockTimed works like Lock, but also returns how long it waited for the lock.
+func (l Lockfile) LockTimed(ctx context.Context, expProcName string) (waited time.Duration, err error) {
+	clock := l.options().clock
+	start := clock.Now()
+	err = l.Lock(ctx, expProcName)
+	return clock.Now().Sub(start), err
+}
+
+// WithRetryable replaces how Lock and LockBlocking tell whether an error of TryLock is worth a retry.
+// The default only retries temporary errors like ErrBusy. A predicate retrying other errors,
+// like transient I/O errors, should still retry those, e.g. by checking errors.Is(err, ErrBusy).
+func WithRetryable(retryable func(error) bool) Option {
+	return func(o *options) {
+		o.retryable = retryable
+	}
+}
+
+// isTemporary reports whether err is worth a retry.
+func isTemporary(err error) bool {
+	var te interface{ Temporary() bool }
+	return errors.As(err, &te) && te.Temporary()
+}
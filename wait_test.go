@@ -0,0 +1,246 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	path, err := filepath.Abs("test_wait.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.Lock(context.Background(), "main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLockCanceled(t *testing.T) {
+	path, err := filepath.Abs("test_wait.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if got := lf.Lock(ctx, name); got != context.DeadlineExceeded {
+		t.Fatalf("expected error %q, got %v", context.DeadlineExceeded, got)
+	}
+}
+
+func TestLockTimed(t *testing.T) {
+	path, err := filepath.Abs("test_wait.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	lf, err := New(path, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waited, err := lf.LockTimed(context.Background(), "main")
+	if err != nil {
+		t.Fatalf("free: unexpected error: %v", err)
+	}
+	if waited != 0 {
+		t.Fatalf("free: got wait %v, want 0", waited)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := writeBusyLockfile(t, path)
+	defer os.Remove(path)
+
+	lf, err = New(path, WithClock(clock), WithLivenessChecker(ownerExitingAfter(os.Getppid(), 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waited, err = lf.LockTimed(context.Background(), name)
+	if err != nil {
+		t.Fatalf("contended: unexpected error: %v", err)
+	}
+
+	if want := 10*time.Millisecond + 20*time.Millisecond + 40*time.Millisecond; waited != want {
+		t.Fatalf("contended: got wait %v, want %v after waits %v", waited, want, clock.waits)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flakyFS fails creating temporary files with EIO the first failures times.
+type flakyFS struct {
+	osFS
+	failures int
+}
+
+func (fs *flakyFS) TempFile(dir, pattern string) (*os.File, error) {
+	if fs.failures > 0 {
+		fs.failures--
+		return nil, &os.PathError{Op: "open", Path: filepath.Join(dir, pattern), Err: syscall.EIO}
+	}
+	return fs.osFS.TempFile(dir, pattern)
+}
+
+func TestWithRetryable(t *testing.T) {
+	path, err := filepath.Abs("test_wait.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retryIO := func(err error) bool {
+		return isTemporary(err) || errors.Is(err, syscall.EIO)
+	}
+
+	tests := [...]struct {
+		opts  []Option
+		xfail error
+	}{
+		{xfail: syscall.EIO},
+		{opts: []Option{WithRetryable(retryIO)}},
+	}
+
+	for step, tc := range tests {
+		clock := newFakeClock()
+		fs := &flakyFS{failures: 2}
+		lf, err := New(path, append(tc.opts, WithClock(clock), withFilesystem(fs))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = lf.Lock(context.Background(), "main")
+		if tc.xfail != nil {
+			if !errors.Is(err, tc.xfail) {
+				t.Errorf("%d: expected error %q, got %v", step, tc.xfail, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+		if len(clock.waits) != 2 {
+			t.Errorf("%d: expected 2 retries, got waits %v", step, clock.waits)
+		}
+		if err := lf.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestObserveWaitDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	retryIO := func(err error) bool {
+		return isTemporary(err) || errors.Is(err, syscall.EIO)
+	}
+
+	tests := [...]struct {
+		failures int
+		opts     []Option
+		waits    []time.Duration
+	}{
+		{waits: []time.Duration{0}},
+		{failures: 2, opts: []Option{WithRetryable(retryIO)}, waits: []time.Duration{2 * time.Second}},
+		{failures: 2}, // failed, so nothing waited for
+	}
+
+	for step, tc := range tests {
+		metrics := &recordingMetrics{}
+		fs := &flakyFS{failures: tc.failures}
+		opts := []Option{WithClock(newFakeClock()), withFilesystem(fs), WithMetrics(metrics), WithBackoff(ConstantBackoff{Delay: time.Second})}
+		lf, err := New(path, append(opts, tc.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lf.Lock(context.Background(), "main"); err == nil {
+			if err := lf.Unlock(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !reflect.DeepEqual(metrics.waits, tc.waits) {
+			t.Errorf("%d: observed waits %v, want %v", step, metrics.waits, tc.waits)
+		}
+	}
+}
+
+func TestAcquireWithin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stale lockfile is reaped right away
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(GetDeadPID())+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := lf.AcquireWithin(context.Background(), "main", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Fatalf("waited %v for a free lock", waited)
+	}
+
+	if err := lf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireWithinBudgetExhausted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+	name := writeBusyLockfile(t, path)
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.AcquireWithin(context.Background(), name, 50*time.Millisecond); err != ErrBusy {
+		t.Fatalf("expected error %q, got %v", ErrBusy, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lf.AcquireWithin(ctx, name, time.Minute); err != context.Canceled {
+		t.Fatalf("canceled: expected error %q, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,37 @@
+package lockfile
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// WithWatchdogDeadline caps the total time Lock waits for the lock to fraction of the systemd watchdog timeout,
+// so a service waiting for its lock during startup still notifies the watchdog in time.
+// The timeout is read from $WATCHDOG_USEC by New. As with sd_watchdog_enabled(3), it is ignored,
+// if $WATCHDOG_PID names another process. Without a valid watchdog timeout, or with fraction <= 0,
+// this option has no effect. Once the deadline passes, Lock returns context.DeadlineExceeded.
+func WithWatchdogDeadline(fraction float64) Option {
+	return func(o *options) {
+		timeout, ok := watchdogTimeout()
+		if !ok || fraction <= 0 {
+			return
+		}
+
+		o.lockTimeout = time.Duration(float64(timeout) * fraction)
+	}
+}
+
+// watchdogTimeout returns the watchdog timeout systemd expects this process to honor, if any.
+func watchdogTimeout() (time.Duration, bool) {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 63)
+	if err != nil || usec == 0 {
+		return 0, false
+	}
+
+	return time.Duration(usec) * time.Microsecond, true
+}
@@ -0,0 +1,65 @@
+package lockfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// setWatchdogEnv sets the watchdog environment for the rest of the test.
+func setWatchdogEnv(t *testing.T, usec, pid string) {
+	t.Setenv("WATCHDOG_USEC", usec)
+	t.Setenv("WATCHDOG_PID", pid)
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+
+	tests := [...]struct {
+		usec    string
+		pid     string
+		timeout time.Duration
+		ok      bool
+	}{
+		{},
+		{usec: "0"},
+		{usec: "-1"},
+		{usec: "junk"},
+		{usec: "3000000", timeout: 3 * time.Second, ok: true},
+		{usec: "3000000", pid: self, timeout: 3 * time.Second, ok: true},
+		{usec: "3000000", pid: strconv.Itoa(os.Getpid() + 1)},
+	}
+
+	for step, tc := range tests {
+		setWatchdogEnv(t, tc.usec, tc.pid)
+
+		timeout, ok := watchdogTimeout()
+		if timeout != tc.timeout || ok != tc.ok {
+			t.Errorf("%d: got %v, %v, want %v, %v", step, timeout, ok, tc.timeout, tc.ok)
+		}
+	}
+}
+
+func TestWithWatchdogDeadline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test_watchdog.pid")
+	name := writeBusyLockfile(t, path)
+
+	setWatchdogEnv(t, "1000000", "")
+
+	lf, err := New(path, WithClock(newFakeClock()), WithWatchdogDeadline(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waited, err := lf.LockTimed(context.Background(), name)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected error %q, got %v", context.DeadlineExceeded, err)
+	}
+
+	if want := 500 * time.Millisecond; waited != want {
+		t.Fatalf("got wait %v, want %v", waited, want)
+	}
+}
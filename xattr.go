@@ -0,0 +1,61 @@
+package lockfile
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xattrPrefix starts the names of the extended attributes written by WithXattrMetadata.
+const xattrPrefix = "user.lockfile."
+
+// WithXattrMetadata records who acquired the lock and when as extended attributes of the lockfile,
+// keeping its content a plain pidfile. These are the uid, hostname and time of acquisition,
+// see XattrMetadata. Where extended attributes are not supported, they are left out
+// and a warning is sent to the logger given by WithLogger. Only Linux supports them here.
+func WithXattrMetadata() Option {
+	return func(o *options) {
+		o.xattrMetadata = true
+	}
+}
+
+// XattrMetadata returns the extended attributes written by WithXattrMetadata,
+// keyed by "uid", "host" and "acquired". Lockfiles without them return an empty map.
+// Where extended attributes are not supported, ErrXattrUnsupported is returned.
+func (l Lockfile) XattrMetadata() (map[string]string, error) {
+	attrs, err := listXattrs(l.name)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	for name, value := range attrs {
+		if strings.HasPrefix(name, xattrPrefix) {
+			metadata[strings.TrimPrefix(name, xattrPrefix)] = value
+		}
+	}
+
+	return metadata, nil
+}
+
+// setXattrMetadata records who acquires the lock as extended attributes of the file name.
+func (l Lockfile) setXattrMetadata(name string) {
+	host := l.options().hostname
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	metadata := map[string]string{
+		"uid":      strconv.Itoa(os.Getuid()),
+		"host":     host,
+		"acquired": l.options().clock.Now().Format(time.RFC3339Nano),
+	}
+
+	for key, value := range metadata {
+		if err := setXattr(name, xattrPrefix+key, value); err != nil {
+			l.warnf("lockfile: cannot record %s of %s as extended attribute: %v", key, l.name, err)
+			return
+		}
+	}
+}
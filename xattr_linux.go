@@ -0,0 +1,63 @@
+package lockfile
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// setXattr sets the extended attribute attr of the file name to value.
+func setXattr(name, attr, value string) error {
+	return xattrError(syscall.Setxattr(name, attr, []byte(value), 0))
+}
+
+// listXattrs returns all extended attributes of the file name.
+func listXattrs(name string) (map[string]string, error) {
+	size, err := syscall.Listxattr(name, nil)
+	if err != nil {
+		return nil, xattrError(err)
+	}
+
+	list := make([]byte, size)
+	if size, err = syscall.Listxattr(name, list); err != nil {
+		return nil, xattrError(err)
+	}
+
+	attrs := map[string]string{}
+	for _, attr := range bytes.Split(list[:size], []byte{0}) {
+		if len(attr) == 0 {
+			continue
+		}
+
+		value, err := getXattr(name, string(attr))
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(attr)] = value
+	}
+
+	return attrs, nil
+}
+
+// getXattr returns the extended attribute attr of the file name.
+func getXattr(name, attr string) (string, error) {
+	size, err := syscall.Getxattr(name, attr, nil)
+	if err != nil {
+		return "", xattrError(err)
+	}
+
+	value := make([]byte, size)
+	if size, err = syscall.Getxattr(name, attr, value); err != nil {
+		return "", xattrError(err)
+	}
+
+	return string(value[:size]), nil
+}
+
+// xattrError turns the error of a filesystem without extended attributes into ErrXattrUnsupported.
+func xattrError(err error) error {
+	if err == syscall.ENOTSUP {
+		return ErrXattrUnsupported
+	}
+
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package lockfile
+
+// setXattr reports that extended attributes are not supported here.
+func setXattr(name, attr, value string) error {
+	return ErrXattrUnsupported
+}
+
+// listXattrs reports that extended attributes are not supported here.
+func listXattrs(name string) (map[string]string, error) {
+	return nil, ErrXattrUnsupported
+}
@@ -0,0 +1,93 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWithXattrMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	clock := newFakeClock()
+	logger := &recordingLogger{}
+	lf, err := New(path, WithXattrMetadata(), WithHostname("db1"), WithClock(clock), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	metadata, err := lf.XattrMetadata()
+	if err == ErrXattrUnsupported {
+		// degrades to a plain lockfile with a warning
+		if len(logger.warnings) != 1 {
+			t.Fatalf("expected one warning, got %q", logger.warnings)
+		}
+		t.Skip("no extended attributes here")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"uid":      strconv.Itoa(os.Getuid()),
+		"host":     "db1",
+		"acquired": clock.Now().Format(time.RFC3339Nano),
+	}
+	for key, value := range want {
+		if metadata[key] != value {
+			t.Errorf("got %s %q, want %q", key, metadata[key], value)
+		}
+	}
+}
+
+func TestWithXattrMetadataKeepsPidfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path, WithXattrMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lf.Unlock()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(os.Getpid()) + "\n"; string(content) != want {
+		t.Fatalf("got content %q, want %q", content, want)
+	}
+}
+
+func TestXattrMetadataWithout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lck")
+
+	lf, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.TryLock("main"); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Unlock()
+
+	metadata, err := lf.XattrMetadata()
+	if err == ErrXattrUnsupported {
+		t.Skip("no extended attributes here")
+	}
+	if err != nil || len(metadata) != 0 {
+		t.Fatalf("got %v, %v, want no metadata", metadata, err)
+	}
+}
@@ -0,0 +1,38 @@
+package lockfile
+
+import "github.com/shirou/gopsutil/v4/process"
+
+// WithZombieAsDead considers owners, which exited but haven't been reaped by their parent yet, as dead.
+// Such zombies are still found in the process table, so their locks would be busy until their parent waits for them.
+// Where the state of a process is unknown, it is considered running as before.
+func WithZombieAsDead() Option {
+	return func(o *options) {
+		o.zombieAsDead = true
+	}
+}
+
+// isZombie reports whether the process pid is a zombie.
+func (l Lockfile) isZombie(pid int) bool {
+	status, err := l.options().processStatus(pid)
+	if err != nil {
+		return false
+	}
+
+	for _, s := range status {
+		if s == process.Zombie {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processStatus returns the states of the process pid as reported by gopsutil.
+func processStatus(pid int) ([]string, error) {
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, err
+	}
+
+	return proc.Status()
+}
@@ -0,0 +1,50 @@
+package lockfile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func withProcessStatus(status func(pid int) ([]string, error)) Option {
+	return func(o *options) {
+		o.processStatus = status
+	}
+}
+
+func TestWithZombieAsDead(t *testing.T) {
+	alive := func(pid int) (bool, error) { return true, nil }
+	zombie := func(pid int) ([]string, error) { return []string{"zombie"}, nil }
+	sleeping := func(pid int) ([]string, error) { return []string{"sleep"}, nil }
+	unknown := func(pid int) ([]string, error) { return nil, errors.New("no status") }
+
+	tests := [...]struct {
+		opts    []Option
+		running bool
+	}{
+		{opts: []Option{withProcessStatus(zombie)}, running: true},
+		{opts: []Option{WithZombieAsDead(), withProcessStatus(zombie)}, running: false},
+		{opts: []Option{WithZombieAsDead(), withProcessStatus(sleeping)}, running: true},
+		{opts: []Option{WithZombieAsDead(), withProcessStatus(unknown)}, running: true},
+	}
+
+	path, err := filepath.Abs("test_zombie.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for step, tc := range tests {
+		lf, err := New(path, append(tc.opts, WithLivenessChecker(alive))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		running, err := lf.isRunning(42)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", step, err)
+		}
+		if running != tc.running {
+			t.Errorf("%d: expected running %v, got %v", step, tc.running, running)
+		}
+	}
+}